@@ -0,0 +1,63 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	maxInt = int(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+func addOverflows(a, b int) bool {
+	c := a + b
+	return (b > 0 && c < a) || (b < 0 && c > a)
+}
+
+func subOverflows(a, b int) bool {
+	c := a - b
+	return (b < 0 && c < a) || (b > 0 && c > a)
+}
+
+func mulOverflows(a, b int) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	if (a == -1 && b == minInt) || (b == -1 && a == minInt) {
+		return true
+	}
+	return (a*b)/b != a
+}
+
+func divOverflows(a, b int) bool {
+	return a == minInt && b == -1
+}
+
+func negOverflows(a int) bool {
+	return a == minInt
+}
+
+// powOverflows reports whether base raised to the non-negative power exp overflows.
+// Any other base overflows within 64 multiplications.
+func powOverflows(base, exp int) bool {
+	if base >= -1 && base <= 1 {
+		return false
+	}
+	result := 1
+	for ; exp > 0; exp-- {
+		if mulOverflows(result, base) {
+			return true
+		}
+		result *= base
+	}
+	return false
+}
+
+// checkOverflow returns an integer overflow error for the instruction being
+// executed if checked arithmetic is enabled and overflowed is true
+func (i *Interpreter) checkOverflow(overflowed bool, mnemonic string, operands ...int) error {
+	if !i.checkedArithmetic || !overflowed {
+		return nil
+	}
+	return errors.Errorf("integer overflow: %s %v", mnemonic, operands)
+}
@@ -0,0 +1,44 @@
+package crust
+
+import (
+	"testing"
+)
+
+func TestPowOverflows(t *testing.T) {
+	tests := []struct {
+		base, exp int
+		want      bool
+	}{
+		{0, 4000000000000000000, false},
+		{1, 4000000000000000000, false},
+		{-1, 4000000000000000001, false},
+		{2, 62, false},
+		{2, 63, true},
+		{-2, 63, false},
+		{-2, 64, true},
+		{3, 39, false},
+		{3, 40, true},
+		{10, 4000000000000000000, true},
+	}
+	for _, test := range tests {
+		if got := powOverflows(test.base, test.exp); got != test.want {
+			t.Errorf("powOverflows(%d, %d) = %v, want %v", test.base, test.exp, got, test.want)
+		}
+	}
+}
+
+func TestPowLargeExponent(t *testing.T) {
+	for _, checked := range []bool{false, true} {
+		out, err := runSource(t, "ipush 1\nipush 4000000000000000000\npow\nput", WithCheckedArithmetic(checked))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "1" {
+			t.Fatalf("expected 1, got %q", out)
+		}
+	}
+	_, err := runSource(t, "ipush 2\nipush 63\npow", WithCheckedArithmetic(true))
+	if err == nil {
+		t.Fatal("expected 2 ** 63 to overflow")
+	}
+}
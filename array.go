@@ -0,0 +1,43 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// array is a mutable, growable list of values.
+// Arrays are shared by reference when copied on the stack.
+type array struct {
+	values []interface{}
+}
+
+func (a *array) String() string {
+	parts := make([]string, len(a.values))
+	for index, value := range a.values {
+		parts[index] = fmt.Sprint(value)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func (a *array) get(index int) (interface{}, error) {
+	if err := a.checkIndex(index); err != nil {
+		return nil, err
+	}
+	return a.values[index], nil
+}
+
+func (a *array) set(index int, value interface{}) error {
+	if err := a.checkIndex(index); err != nil {
+		return err
+	}
+	a.values[index] = value
+	return nil
+}
+
+func (a *array) checkIndex(index int) error {
+	if index < 0 || index >= len(a.values) {
+		return errors.Errorf("array index %d out of range [0, %d)", index, len(a.values))
+	}
+	return nil
+}
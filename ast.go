@@ -0,0 +1,49 @@
+package crust
+
+// Instruction is an instruction as it was parsed: its op code, its arguments
+// in the order of its signature, and where it was written
+type Instruction struct {
+	OpCode   OpCode
+	Args     []interface{}
+	Position Position
+}
+
+// Label is a line number argument that was written as the name of a label
+type Label string
+
+// Mnemonic returns the name the instruction is written with
+func (in Instruction) Mnemonic() string {
+	return opMnemonics()[in.OpCode]
+}
+
+// AST returns the program's instructions as they were parsed, in order. Line
+// number arguments written as labels are a Label rather than the line they refer
+// to, and lists of lines with any written as labels are an []interface{} of ints
+// and Labels. Instructions of programs that were not parsed from source have no position.
+func (p *Program) AST() []Instruction {
+	return append([]Instruction(nil), p.ast...)
+}
+
+// newInstruction returns the node for an op code and its arguments as they are
+// laid out in a program's instructions, before labels are resolved
+func newInstruction(instruction []interface{}, pos Position) Instruction {
+	args := make([]interface{}, len(instruction)-1)
+	for index, arg := range instruction[1:] {
+		switch ref := arg.(type) {
+		case labelRef:
+			arg = Label(ref.name)
+		case lineListRef:
+			lines := make([]interface{}, len(ref))
+			for position, line := range ref {
+				if line, ok := line.(labelRef); ok {
+					lines[position] = Label(line.name)
+					continue
+				}
+				lines[position] = line
+			}
+			arg = lines
+		}
+		args[index] = arg
+	}
+	return Instruction{OpCode: instruction[0].(OpCode), Args: args, Position: pos}
+}
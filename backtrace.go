@@ -0,0 +1,53 @@
+package crust
+
+import (
+	"fmt"
+)
+
+// TraceFrame is a position on a program's call stack
+type TraceFrame struct {
+	// Line is the 1-based line number of the instruction
+	Line int
+
+	// File and SourceLine are the original source position declared by
+	// a .line directive. File is empty if there is none.
+	File       string
+	SourceLine int
+}
+
+func (f TraceFrame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("line %d", f.Line)
+	}
+	return fmt.Sprintf("%s:%d (line %d)", f.File, f.SourceLine, f.Line)
+}
+
+// Backtrace returns the call stack of the running coroutine, starting with
+// the next instruction to execute followed by the call sites of each active call
+func (i *Interpreter) Backtrace() []TraceFrame {
+	return i.backtrace(i.ip)
+}
+
+// backtrace returns the call stack of the running coroutine
+// starting at the instruction index ip
+func (i *Interpreter) backtrace(ip int) []TraceFrame {
+	trace := []TraceFrame{i.traceFrame(ip)}
+	for index := len(i.frames) - 1; index >= 0; index-- {
+		returnIP := i.frames[index].returnIP
+		if returnIP == coroutineExitIP {
+			continue
+		}
+		// the return position follows the call instruction
+		trace = append(trace, i.traceFrame(returnIP-1))
+	}
+	return trace
+}
+
+func (i *Interpreter) traceFrame(ip int) TraceFrame {
+	f := TraceFrame{Line: i.program.lineOf(ip)}
+	if mark, ok := i.program.sourceOf(ip); ok {
+		f.File = mark.file
+		f.SourceLine = mark.line
+	}
+	return f
+}
@@ -0,0 +1,30 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrBreakpoint is returned by Step and Run when a brk instruction is executed
+// and no breakpoint handler is set. Execution resumes after the brk instruction
+// on the next call to Step or Run.
+var ErrBreakpoint = errors.New("breakpoint")
+
+// WithBreakpointHandler sets a function called with the line number of each
+// executed brk instruction. Execution continues after the handler returns,
+// unless it returns an error, which stops the program.
+func WithBreakpointHandler(handler func(line int) error) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.onBreakpoint = handler
+	}
+}
+
+// breakpoint pauses execution at the brk instruction just executed
+func (i *Interpreter) breakpoint() error {
+	if i.onBreakpoint == nil {
+		return ErrBreakpoint
+	}
+	if err := i.onBreakpoint(i.program.lineOf(i.ip - 1)); err != nil {
+		return &uncatchableError{err}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// buffer is a fixed-length, mutable sequence of bytes.
+// Buffers are shared by reference when copied on the stack.
+type buffer struct {
+	bytes []byte
+}
+
+func (b *buffer) String() string {
+	return fmt.Sprintf("bytes(%x)", b.bytes)
+}
+
+func (b *buffer) get(index int) (int, error) {
+	if err := b.checkIndex(index); err != nil {
+		return 0, err
+	}
+	return int(b.bytes[index]), nil
+}
+
+func (b *buffer) set(index int, value int) error {
+	if err := b.checkIndex(index); err != nil {
+		return err
+	}
+	if value < 0 || value > 255 {
+		return errors.Errorf("byte value %d out of range [0, 256)", value)
+	}
+	b.bytes[index] = byte(value)
+	return nil
+}
+
+func (b *buffer) checkIndex(index int) error {
+	if index < 0 || index >= len(b.bytes) {
+		return errors.Errorf("buffer index %d out of range [0, %d)", index, len(b.bytes))
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// ProgramBuilder constructs a Program from Go code without writing and parsing
+// its text. Methods can be chained, and the first error encountered is reported
+// by Build. Line number arguments may be given as an int or as the name of a label.
+type ProgramBuilder struct {
+	program *Program
+	labels  map[string]int
+	err     error
+}
+
+// NewProgramBuilder returns a builder for an empty program
+func NewProgramBuilder() *ProgramBuilder {
+	return &ProgramBuilder{
+		program: &Program{},
+		labels:  make(map[string]int),
+	}
+}
+
+// Label defines name as a label of the next instruction added
+func (b *ProgramBuilder) Label(name string) *ProgramBuilder {
+	if b.err == nil {
+		b.err = defineLabel(b.labels, name, len(b.program.jumpTable)+1)
+	}
+	return b
+}
+
+// Op adds an instruction, checking its arguments against the signature of op
+func (b *ProgramBuilder) Op(op OpCode, args ...interface{}) *ProgramBuilder {
+	if b.err != nil {
+		return b
+	}
+	mnemonic, ok := opMnemonics()[op]
+	if !ok {
+		b.err = errors.Errorf("invalid op code: %v", op)
+		return b
+	}
+	signature := instructionSignatures()[mnemonic]
+	if len(args) != len(signature.args) {
+		b.err = errors.Errorf("%s takes %d arguments, got %d", mnemonic, len(signature.args), len(args))
+		return b
+	}
+	instruction := make([]interface{}, 0, 1+len(args))
+	instruction = append(instruction, op)
+	for index, arg := range args {
+		value, err := builderArgument(signature.args[index], arg)
+		if err != nil {
+			b.err = errors.Wrapf(err, "%s argument %d", mnemonic, index+1)
+			return b
+		}
+		instruction = append(instruction, value)
+	}
+	b.program.jumpTable = append(b.program.jumpTable, len(b.program.instructions))
+	b.program.instructions = append(b.program.instructions, instruction...)
+	b.program.ast = append(b.program.ast, newInstruction(instruction, Position{}))
+	return b
+}
+
+// builderArgument validates a Go value given as an argument of the type argType
+func builderArgument(argType ArgType, arg interface{}) (interface{}, error) {
+	switch value := arg.(type) {
+	case int:
+		if argType == ArgInt || argType == ArgLine {
+			return value, nil
+		}
+	case string:
+		if argType == ArgString {
+			return value, nil
+		}
+		if argType == ArgLine {
+			if !isLabelName(value) {
+				return nil, errors.Errorf("invalid label name %q", value)
+			}
+			return labelRef{name: value}, nil
+		}
+	case float64:
+		if argType == ArgFloat {
+			return value, nil
+		}
+	case bool:
+		if argType == ArgBool {
+			return value, nil
+		}
+	case []int:
+		if argType == ArgIntList {
+			return append([]int(nil), value...), nil
+		}
+	case *big.Int:
+		if argType == ArgBigInt {
+			return new(big.Int).Set(value), nil
+		}
+	}
+	return nil, errors.Errorf("expected %s, got %T", argType, arg)
+}
+
+// Build returns the program, resolving the labels it refers to.
+// An error is returned if the program fails Verify.
+func (b *ProgramBuilder) Build() (*Program, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	program := &Program{
+		instructions: append([]interface{}(nil), b.program.instructions...),
+		jumpTable:    append([]int(nil), b.program.jumpTable...),
+		ast:          append([]Instruction(nil), b.program.ast...),
+	}
+	for index, instruction := range program.instructions {
+		resolved, err := resolveRefs(instruction, func(ref labelRef) (int, error) {
+			line, ok := b.labels[ref.name]
+			if !ok {
+				return 0, errors.Errorf("undefined label %s", ref.name)
+			}
+			return line, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		program.instructions[index] = resolved
+	}
+	if err := Verify(program); err != nil {
+		return nil, errors.Wrap(err, "unable to build program")
+	}
+	return program, nil
+}
+
+// Putln adds a putln instruction
+func (b *ProgramBuilder) Putln() *ProgramBuilder {
+	return b.Op(OpPutln)
+}
+
+// Dup adds a dup instruction
+func (b *ProgramBuilder) Dup() *ProgramBuilder {
+	return b.Op(OpDup)
+}
+
+// Put adds a put instruction
+func (b *ProgramBuilder) Put() *ProgramBuilder {
+	return b.Op(OpPut)
+}
+
+// Jump adds a jump instruction to a line number or label
+func (b *ProgramBuilder) Jump(line interface{}) *ProgramBuilder {
+	return b.Op(OpJump, line)
+}
+
+// JumpLessThan adds a jumpl instruction to a line number or label
+func (b *ProgramBuilder) JumpLessThan(value int, line interface{}) *ProgramBuilder {
+	return b.Op(OpJumpLessThan, value, line)
+}
+
+// Halt adds a halt instruction
+func (b *ProgramBuilder) Halt(status int) *ProgramBuilder {
+	return b.Op(OpHalt, status)
+}
+
+// Nop adds a nop instruction
+func (b *ProgramBuilder) Nop() *ProgramBuilder {
+	return b.Op(OpNop)
+}
+
+// Ipush adds an ipush instruction
+func (b *ProgramBuilder) Ipush(value int) *ProgramBuilder {
+	return b.Op(OpIpush, value)
+}
+
+// Iadd adds an iadd instruction
+func (b *ProgramBuilder) Iadd() *ProgramBuilder {
+	return b.Op(OpIadd)
+}
+
+// Isub adds an isub instruction
+func (b *ProgramBuilder) Isub() *ProgramBuilder {
+	return b.Op(OpIsubtract)
+}
+
+// Imul adds an imul instruction
+func (b *ProgramBuilder) Imul() *ProgramBuilder {
+	return b.Op(OpImultiply)
+}
+
+// Idiv adds an idiv instruction
+func (b *ProgramBuilder) Idiv() *ProgramBuilder {
+	return b.Op(OpIdivide)
+}
+
+// Iinc adds an iinc instruction
+func (b *ProgramBuilder) Iinc(value int) *ProgramBuilder {
+	return b.Op(OpIincrement, value)
+}
+
+// Spush adds an spush instruction
+func (b *ProgramBuilder) Spush(value string) *ProgramBuilder {
+	return b.Op(OpSpush, value)
+}
+
+// Sadd adds an sadd instruction
+func (b *ProgramBuilder) Sadd() *ProgramBuilder {
+	return b.Op(OpSadd)
+}
+
+// Fpush adds an fpush instruction
+func (b *ProgramBuilder) Fpush(value float64) *ProgramBuilder {
+	return b.Op(OpFpush, value)
+}
+
+// Bpush adds a bpush instruction
+func (b *ProgramBuilder) Bpush(value bool) *ProgramBuilder {
+	return b.Op(OpBpush, value)
+}
+
+// Swap adds a swap instruction
+func (b *ProgramBuilder) Swap() *ProgramBuilder {
+	return b.Op(OpSwap)
+}
+
+// Drop adds a drop instruction
+func (b *ProgramBuilder) Drop() *ProgramBuilder {
+	return b.Op(OpDrop)
+}
+
+// Jz adds a jz instruction to a line number or label
+func (b *ProgramBuilder) Jz(line interface{}) *ProgramBuilder {
+	return b.Op(OpJumpZero, line)
+}
+
+// Jnz adds a jnz instruction to a line number or label
+func (b *ProgramBuilder) Jnz(line interface{}) *ProgramBuilder {
+	return b.Op(OpJumpNotZero, line)
+}
+
+// Call adds a call instruction to a line number or label
+func (b *ProgramBuilder) Call(line interface{}) *ProgramBuilder {
+	return b.Op(OpCall, line)
+}
+
+// Ret adds a ret instruction
+func (b *ProgramBuilder) Ret() *ProgramBuilder {
+	return b.Op(OpReturn)
+}
+
+// Loadl adds a loadl instruction
+func (b *ProgramBuilder) Loadl(slot int) *ProgramBuilder {
+	return b.Op(OpLoadl, slot)
+}
+
+// Storel adds a storel instruction
+func (b *ProgramBuilder) Storel(slot int) *ProgramBuilder {
+	return b.Op(OpStorel, slot)
+}
+
+// Gload adds a gload instruction
+func (b *ProgramBuilder) Gload(slot int) *ProgramBuilder {
+	return b.Op(OpGload, slot)
+}
+
+// Gstore adds a gstore instruction
+func (b *ProgramBuilder) Gstore(slot int) *ProgramBuilder {
+	return b.Op(OpGstore, slot)
+}
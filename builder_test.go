@@ -0,0 +1,62 @@
+package crust
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuildLabels(t *testing.T) {
+	program, err := NewProgramBuilder().
+		Ipush(0).
+		Jz("done").
+		Spush("skipped").
+		Put().
+		Label("done").
+		Spush("done").
+		Put().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	if err := NewInterpreter(program, WithStdout(&stdout)).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "done" {
+		t.Fatalf("expected the jump to the label, got %q", stdout.String())
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := map[string]struct {
+		builder *ProgramBuilder
+		want    string
+	}{
+		"undefined label": {
+			builder: NewProgramBuilder().Jump("missing"),
+			want:    "undefined label missing",
+		},
+		"jump out of range": {
+			builder: NewProgramBuilder().Ipush(1).Jump(9),
+			want:    "line 9",
+		},
+		"jump table out of range": {
+			builder: NewProgramBuilder().Ipush(0).Op(OpJumpTable, []int{1, 7}, 1),
+			want:    "line 7",
+		},
+		"wrong argument": {
+			builder: NewProgramBuilder().Op(OpIpush, "1"),
+			want:    "expected int",
+		},
+	}
+	for name, test := range tests {
+		program, err := test.builder.Build()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%s: expected an error containing %q, got %v", name, test.want, err)
+		}
+		if program != nil {
+			t.Fatalf("%s: expected no program", name)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package crust
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"math/big"
+)
+
+// bytecodeMagic starts every program encoded by Encode
+var bytecodeMagic = []byte("CRST")
+
+// BytecodeVersion is the version of the binary format written by Encode.
+// DecodeProgram reads this version and earlier ones.
+const BytecodeVersion = 1
+
+// maxBytecodePrealloc limits how many elements a decoder allocates up front from
+// a count it has read, so that corrupt counts fail at the end of input instead
+const maxBytecodePrealloc = 1 << 16
+
+// Encode writes the program in a compact binary format that DecodeProgram reads
+// back: a magic header and format version, followed by the entry point, the
+// constant pool, the instruction stream, the jump table, the exported symbols
+// and the .line marks. Instruction positions in the source are not kept.
+func (p *Program) Encode(w io.Writer) error {
+	e := &bytecodeWriter{w: bufio.NewWriter(w)}
+	e.w.Write(bytecodeMagic)
+	e.uvarint(BytecodeVersion)
+	e.varint(p.entry)
+
+	e.uvarint(len(p.constants))
+	for index, value := range p.constants {
+		argType, ok := constantArgType(value)
+		if !ok {
+			return errors.Errorf("invalid constant %d: %v", index, value)
+		}
+		e.w.WriteByte(byte(argType))
+		e.arg(argType, value)
+	}
+
+	e.uvarint(p.opCount())
+	err := p.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		e.w.WriteByte(byte(op))
+		for index, argType := range signature.args {
+			if !e.arg(argType, p.instructions[ip+1+index]) {
+				return errors.Errorf("invalid %s argument of %s at ip %d: %v", argType, opMnemonics()[op], ip, p.instructions[ip+1+index])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	e.uvarint(len(p.jumpTable))
+	for _, ip := range p.jumpTable {
+		e.uvarint(ip)
+	}
+
+	e.uvarint(len(p.symbols))
+	for _, symbol := range p.symbols {
+		e.string(symbol.Name)
+		e.varint(symbol.Line)
+		e.bool(symbol.Extern)
+	}
+
+	e.uvarint(len(p.marks))
+	for _, mark := range p.marks {
+		e.uvarint(mark.ip)
+		e.string(mark.file)
+		e.varint(mark.line)
+	}
+	return errors.Wrap(e.w.Flush(), "unable to write bytecode")
+}
+
+// Hash returns a hex encoded SHA-256 digest of the program as written by Encode.
+// Programs with the same hash have the same instructions, jump table, constants,
+// entry point, symbols and .line marks, however they were written.
+func (p *Program) Hash() (string, error) {
+	h := sha256.New()
+	if err := p.Encode(h); err != nil {
+		return "", errors.Wrap(err, "unable to hash program")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DecodeProgram reads a program written by Encode. Decoded programs have no
+// source positions, so their runtime errors are located by line number
+// unless a .line mark covers the instruction.
+func DecodeProgram(r io.Reader) (*Program, error) {
+	program, err := decodeProgram(&bytecodeReader{r: bufio.NewReader(r)})
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.Wrap(err, "unable to decode program")
+	}
+	if err := Verify(program); err != nil {
+		return nil, errors.Wrap(err, "unable to decode program")
+	}
+	return program, nil
+}
+
+func decodeProgram(d *bytecodeReader) (*Program, error) {
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || !bytes.Equal(magic, bytecodeMagic) {
+		return nil, errors.New("not crust bytecode")
+	}
+	version, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > BytecodeVersion {
+		return nil, errors.Errorf("unsupported bytecode version %d", version)
+	}
+	program := &Program{}
+	if program.entry, err = d.varint(); err != nil {
+		return nil, err
+	}
+
+	count, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	program.constants = make([]interface{}, 0, smaller(count, maxBytecodePrealloc))
+	for index := 0; index < count; index++ {
+		tag, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if !isConstantType(ArgType(tag)) {
+			return nil, errors.Errorf("invalid constant type %d", tag)
+		}
+		value, err := d.arg(ArgType(tag))
+		if err != nil {
+			return nil, err
+		}
+		program.constants = append(program.constants, value)
+	}
+
+	if count, err = d.uvarint(); err != nil {
+		return nil, err
+	}
+	program.instructions = make([]interface{}, 0, smaller(count, maxBytecodePrealloc))
+	for index := 0; index < count; index++ {
+		code, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		op := OpCode(code)
+		mnemonic, ok := opMnemonics()[op]
+		if !ok {
+			return nil, errors.Errorf("invalid op code: %v", op)
+		}
+		program.instructions = append(program.instructions, op)
+		for _, argType := range instructionSignatures()[mnemonic].args {
+			value, err := d.arg(argType)
+			if err != nil {
+				return nil, err
+			}
+			program.instructions = append(program.instructions, value)
+		}
+	}
+
+	if count, err = d.uvarint(); err != nil {
+		return nil, err
+	}
+	program.jumpTable = make([]int, 0, smaller(count, maxBytecodePrealloc))
+	for index := 0; index < count; index++ {
+		ip, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if ip > len(program.instructions) {
+			return nil, errors.Errorf("invalid jump table entry %d", ip)
+		}
+		program.jumpTable = append(program.jumpTable, ip)
+	}
+
+	if count, err = d.uvarint(); err != nil {
+		return nil, err
+	}
+	for index := 0; index < count; index++ {
+		var symbol Symbol
+		if symbol.Name, err = d.string(); err != nil {
+			return nil, err
+		}
+		if symbol.Line, err = d.varint(); err != nil {
+			return nil, err
+		}
+		if symbol.Extern, err = d.bool(); err != nil {
+			return nil, err
+		}
+		program.symbols = append(program.symbols, symbol)
+	}
+
+	if count, err = d.uvarint(); err != nil {
+		return nil, err
+	}
+	for index := 0; index < count; index++ {
+		var mark sourceMark
+		if mark.ip, err = d.uvarint(); err != nil {
+			return nil, err
+		}
+		if mark.file, err = d.string(); err != nil {
+			return nil, err
+		}
+		if mark.line, err = d.varint(); err != nil {
+			return nil, err
+		}
+		program.marks = append(program.marks, mark)
+	}
+	return program, nil
+}
+
+// constantArgType returns the argument type a constant pool value is encoded as
+func constantArgType(value interface{}) (ArgType, bool) {
+	kind, ok := dataKind(value)
+	if !ok {
+		return 0, false
+	}
+	return constantTypes[kind], true
+}
+
+// isConstantType reports whether constants of the argument type can be declared in a .data section
+func isConstantType(argType ArgType) bool {
+	for _, constantType := range constantTypes {
+		if argType == constantType {
+			return true
+		}
+	}
+	return false
+}
+
+// smaller returns the smaller of a and b
+func smaller(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// bytecodeWriter writes the parts of encoded programs. Errors are kept by
+// the underlying writer and returned when it is flushed.
+type bytecodeWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *bytecodeWriter) uvarint(value int) {
+	n := binary.PutUvarint(e.buf[:], uint64(value))
+	e.w.Write(e.buf[:n])
+}
+
+func (e *bytecodeWriter) varint(value int) {
+	n := binary.PutVarint(e.buf[:], int64(value))
+	e.w.Write(e.buf[:n])
+}
+
+func (e *bytecodeWriter) string(value string) {
+	e.uvarint(len(value))
+	e.w.WriteString(value)
+}
+
+func (e *bytecodeWriter) bool(value bool) {
+	if value {
+		e.w.WriteByte(1)
+	} else {
+		e.w.WriteByte(0)
+	}
+}
+
+// arg writes an argument of the given type, returning false if value is not of that type
+func (e *bytecodeWriter) arg(argType ArgType, value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		if argType != ArgInt && argType != ArgLine {
+			return false
+		}
+		e.varint(v)
+	case string:
+		if argType != ArgString {
+			return false
+		}
+		e.string(v)
+	case float64:
+		if argType != ArgFloat {
+			return false
+		}
+		binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(v))
+		e.w.Write(e.buf[:8])
+	case bool:
+		if argType != ArgBool {
+			return false
+		}
+		e.bool(v)
+	case []int:
+		if argType != ArgIntList {
+			return false
+		}
+		e.uvarint(len(v))
+		for _, element := range v {
+			e.varint(element)
+		}
+	case *big.Int:
+		if argType != ArgBigInt {
+			return false
+		}
+		e.string(v.String())
+	default:
+		return false
+	}
+	return true
+}
+
+// bytecodeReader reads the parts of encoded programs
+type bytecodeReader struct {
+	r *bufio.Reader
+}
+
+func (d *bytecodeReader) uvarint() (int, error) {
+	value, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, err
+	}
+	if value > math.MaxInt32 {
+		return 0, errors.Errorf("invalid count %d", value)
+	}
+	return int(value), nil
+}
+
+func (d *bytecodeReader) varint() (int, error) {
+	value, err := binary.ReadVarint(d.r)
+	return int(value), err
+}
+
+func (d *bytecodeReader) string() (string, error) {
+	length, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(length)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (d *bytecodeReader) bool() (bool, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	if b > 1 {
+		return false, errors.Errorf("invalid bool %d", b)
+	}
+	return b == 1, nil
+}
+
+// arg reads an argument of the given type
+func (d *bytecodeReader) arg(argType ArgType) (interface{}, error) {
+	switch argType {
+	case ArgInt, ArgLine:
+		return d.varint()
+	case ArgString:
+		return d.string()
+	case ArgFloat:
+		var buf [8]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+	case ArgBool:
+		return d.bool()
+	case ArgIntList:
+		length, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]int, 0, smaller(length, maxBytecodePrealloc))
+		for len(values) < length {
+			value, err := d.varint()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case ArgBigInt:
+		text, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		value, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return nil, errors.Errorf("invalid bigint %s", text)
+		}
+		return value, nil
+	}
+	return nil, errors.Errorf("unknown argument type %d", argType)
+}
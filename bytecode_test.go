@@ -0,0 +1,92 @@
+package crust
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const bytecodeSource = `
+.data
+	string "count "
+	bigint 100000000000000000000
+.text
+	ipush 0
+loop:	iinc 1
+	dup
+	jumpl 10 loop
+	loadc 0
+	put
+	put
+	loadc 1
+	put
+	fpush 0.5
+	put
+	bpush true
+	put
+	ipush 1
+	jtable 2 loop done done
+done:	putln
+`
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	program, err := NewProgramFromReader(strings.NewReader(bytecodeSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	if err := program.Encode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeProgram(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got bytes.Buffer
+	if err := NewInterpreter(program, WithStdout(&want)).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInterpreter(decoded, WithStdout(&got)).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(want.String(), "count 10100000000000000000000") || got.String() != want.String() {
+		t.Fatalf("expected the decoded program to print %q, got %q", want.String(), got.String())
+	}
+	var reencoded bytes.Buffer
+	if err := decoded.Encode(&reencoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded.Bytes(), reencoded.Bytes()) {
+		t.Fatal("expected the decoded program to encode the same bytes")
+	}
+
+	if _, err := DecodeProgram(bytes.NewReader(encoded.Bytes()[:encoded.Len()-1])); err == nil {
+		t.Fatal("expected an error decoding truncated bytecode")
+	}
+}
+
+func TestHashStable(t *testing.T) {
+	hash := func(src string) string {
+		program, err := NewProgramFromReader(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := program.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	original := hash(bytecodeSource)
+	if again := hash(bytecodeSource); again != original {
+		t.Fatalf("expected the same hash each time, got %s and %s", original, again)
+	}
+	rewritten := strings.Replace(bytecodeSource, "loop:\tiinc 1", "# comment\nloop:\n\tiinc 1", 1)
+	if hash(rewritten) != original {
+		t.Fatal("expected comments and layout not to change the hash")
+	}
+	changed := strings.Replace(bytecodeSource, "jumpl 10", "jumpl 11", 1)
+	if hash(changed) == original {
+		t.Fatal("expected a different instruction to change the hash")
+	}
+}
@@ -0,0 +1,172 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// BasicBlock is a run of instructions that control only enters at the first
+// instruction and only leaves after the last
+type BasicBlock struct {
+	// Index is the block's position in its CFG's Blocks
+	Index int
+
+	// Start is the position of the block's first instruction
+	// and End is the position just past its last
+	Start int
+	End   int
+
+	// Successors and Predecessors are the indexes of the blocks
+	// control can move to from this block and from which it can reach it
+	Successors   []int
+	Predecessors []int
+}
+
+// CFG is the control flow graph of a program
+type CFG struct {
+	// Blocks are the program's basic blocks in the order of their instructions
+	Blocks []*BasicBlock
+
+	// Entry is the index of the block the program starts running at, -1 if the program is empty
+	Entry int
+
+	// Procedures are the indexes of the blocks that start procedures called
+	// with call or tcall, functions pushed with cpush and coroutines started
+	// with spawn, in the order of their instructions
+	Procedures []int
+}
+
+// AnalyzeCFG divides the program into basic blocks and finds the ways control
+// can move between them. Blocks end at instructions that jump, branch, install
+// an exception handler or leave the current call, and start at the targets of
+// those instructions. Calls continue to the next instruction, so the blocks of a
+// procedure are reached from CFG.Procedures and not from its callers. Blocks
+// ending in jumpd, ret, throw or halt have no successors. It returns an error if
+// the program fails Verify.
+func AnalyzeCFG(program *Program) (*CFG, error) {
+	if err := Verify(program); err != nil {
+		return nil, errors.Wrap(err, "unable to analyze control flow")
+	}
+	cfg := &CFG{Entry: -1}
+	if len(program.instructions) == 0 {
+		return cfg, nil
+	}
+
+	entry := 0
+	if program.entry != 0 {
+		entry, _ = program.lineStart(program.entry)
+	}
+	leaders := map[int]bool{0: true, entry: true}
+	procedures := map[int]bool{}
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		targets, continues := program.flowOf(ip, op)
+		for _, target := range targets {
+			leaders[target] = true
+		}
+		if len(targets) > 0 || !continues {
+			leaders[ip+1+len(signature.args)] = true
+		}
+		switch op {
+		case OpCall, OpTailCall, OpSpawn, OpCpush:
+			if target, ok := program.lineStart(program.instructions[ip+1].(int)); ok {
+				leaders[target] = true
+				procedures[target] = true
+			}
+		}
+		return nil
+	})
+	delete(leaders, len(program.instructions))
+
+	starts := make([]int, 0, len(leaders))
+	for ip := range leaders {
+		starts = append(starts, ip)
+	}
+	sort.Ints(starts)
+	for index, start := range starts {
+		end := len(program.instructions)
+		if index+1 < len(starts) {
+			end = starts[index+1]
+		}
+		cfg.Blocks = append(cfg.Blocks, &BasicBlock{Index: index, Start: start, End: end})
+	}
+	if block, ok := cfg.BlockAt(entry); ok {
+		cfg.Entry = block.Index
+	}
+	for _, start := range starts {
+		if procedures[start] {
+			cfg.Procedures = append(cfg.Procedures, cfg.blockIndex(start))
+		}
+	}
+
+	for _, block := range cfg.Blocks {
+		last, next := block.Start, block.Start
+		for next < block.End {
+			last = next
+			op := program.instructions[last].(OpCode)
+			next = last + 1 + len(instructionSignatures()[opMnemonics()[op]].args)
+		}
+		targets, continues := program.flowOf(last, program.instructions[last].(OpCode))
+		if continues && next < len(program.instructions) {
+			targets = append(targets, next)
+		}
+		for _, target := range targets {
+			// jumping past the last instruction ends the program
+			if successor, ok := cfg.BlockAt(target); ok {
+				cfg.link(block, successor)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// link adds an edge from block to successor unless there already is one
+func (g *CFG) link(block, successor *BasicBlock) {
+	for _, index := range block.Successors {
+		if index == successor.Index {
+			return
+		}
+	}
+	block.Successors = append(block.Successors, successor.Index)
+	successor.Predecessors = append(successor.Predecessors, block.Index)
+}
+
+// blockIndex returns the index of the block holding the instruction at ip
+func (g *CFG) blockIndex(ip int) int {
+	return sort.Search(len(g.Blocks), func(index int) bool {
+		return g.Blocks[index].End > ip
+	})
+}
+
+// BlockAt returns the block holding the instruction at ip, false if ip is outside the program
+func (g *CFG) BlockAt(ip int) (*BasicBlock, bool) {
+	index := g.blockIndex(ip)
+	if ip < 0 || index >= len(g.Blocks) {
+		return nil, false
+	}
+	return g.Blocks[index], true
+}
+
+// Reachable reports, by block index, whether control can reach each block from
+// the entry block or from the start of a procedure
+func (g *CFG) Reachable() []bool {
+	reachable := make([]bool, len(g.Blocks))
+	var work []int
+	visit := func(index int) {
+		if index >= 0 && !reachable[index] {
+			reachable[index] = true
+			work = append(work, index)
+		}
+	}
+	visit(g.Entry)
+	for _, index := range g.Procedures {
+		visit(index)
+	}
+	for len(work) > 0 {
+		block := g.Blocks[work[len(work)-1]]
+		work = work[:len(work)-1]
+		for _, index := range block.Successors {
+			visit(index)
+		}
+	}
+	return reachable
+}
@@ -0,0 +1,49 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// channel is a buffered queue of values passed between coroutines.
+// Channels are shared by reference when copied on the stack.
+type channel struct {
+	buffer   []interface{}
+	capacity int
+}
+
+func (c *channel) String() string {
+	return fmt.Sprintf("chan(%d/%d)", len(c.buffer), c.capacity)
+}
+
+func (c *channel) full() bool {
+	return len(c.buffer) >= c.capacity
+}
+
+func (c *channel) empty() bool {
+	return len(c.buffer) == 0
+}
+
+// block rewinds the current coroutine to retry the instruction it is executing
+// and yields to the next coroutine. If every coroutine is blocked, no channel can
+// make progress and a deadlock error is returned.
+func (i *Interpreter) block(opIP int) error {
+	i.ip = opIP
+	i.blocked = true
+	for _, co := range i.runQueue {
+		if !co.blocked {
+			i.yield()
+			return nil
+		}
+	}
+	return &uncatchableError{errors.New("deadlock: every coroutine is blocked on a channel")}
+}
+
+// unblockAll marks every coroutine as able to retry its channel operation
+// after a channel has changed state
+func (i *Interpreter) unblockAll() {
+	i.blocked = false
+	for _, co := range i.runQueue {
+		co.blocked = false
+	}
+}
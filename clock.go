@@ -0,0 +1,23 @@
+package crust
+
+import (
+	"time"
+)
+
+// Clock is the source of time for time instructions
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// systemClock is a Clock that reads the system time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// millis converts a duration to whole milliseconds
+func millis(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package crust
+
+import (
+	"io"
+)
+
+// coroutine is an execution context of a program. Every coroutine of an
+// interpreter shares the program, variables and heap, but has its own
+// instruction pointer, stack, call stack and exception handlers.
+type coroutine struct {
+	// id identifies the coroutine in debug logs, the initial coroutine is 0
+	id int
+
+	// ip is the current instruction pointer
+	ip int
+
+	// stack is the state of the program
+	stack []interface{}
+
+	// frames is the call stack, the most recent call is last
+	frames []frame
+
+	// handlers is the exception handler stack, the most recent try is last
+	handlers []handler
+
+	// blocked is set while the coroutine is waiting on a channel
+	blocked bool
+}
+
+// coroutineExitIP is the return position of the frame a spawned
+// coroutine starts in, returning to it finishes the coroutine
+const coroutineExitIP = -1
+
+func newCoroutine(id, ip int) *coroutine {
+	return &coroutine{
+		id:     id,
+		ip:     ip,
+		stack:  make([]interface{}, 0, 64),
+		frames: make([]frame, 0, 16),
+	}
+}
+
+// spawn creates a coroutine that calls line and queues it to run
+func (i *Interpreter) spawn(line int) (*coroutine, error) {
+	ip, err := i.lineIP(line)
+	if err != nil {
+		return nil, err
+	}
+	i.spawned++
+	co := newCoroutine(i.spawned, ip)
+	co.frames = append(co.frames, frame{returnIP: coroutineExitIP})
+	i.runQueue = append(i.runQueue, co)
+	return co, nil
+}
+
+// yield moves the current coroutine to the back of the run queue
+// and resumes the coroutine at the front
+func (i *Interpreter) yield() {
+	if len(i.runQueue) == 0 {
+		return
+	}
+	i.runQueue = append(i.runQueue, i.coroutine)
+	i.coroutine, i.runQueue = i.runQueue[0], i.runQueue[1:]
+}
+
+// finishCoroutine discards the current coroutine and resumes the coroutine
+// at the front of the run queue. Once every coroutine has finished, EOF is returned.
+func (i *Interpreter) finishCoroutine() error {
+	i.dlog("coroutine %d finished", i.id)
+	if len(i.runQueue) == 0 {
+		return io.EOF
+	}
+	i.coroutine, i.runQueue = i.runQueue[0], i.runQueue[1:]
+	return nil
+}
@@ -0,0 +1,100 @@
+package crust
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYield(t *testing.T) {
+	out, err := runSource(t, `
+		jump main
+	other:	spush b
+		put
+		yield
+		spush d
+		put
+		ret
+	main:	spawn other
+		spush a
+		put
+		yield
+		spush c
+		put
+		yield
+		spush e
+		put
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "abcde" {
+		t.Fatalf("expected the coroutines to take turns, got %q", out)
+	}
+}
+
+func TestChannelHandoff(t *testing.T) {
+	out, err := runSource(t, `
+		jump main
+	producer:
+		ipush 1
+	send:	dup
+		gload 0
+		swap
+		chsend
+		spush "s"
+		put
+		iinc 1
+		dup
+		jumpl 4 send
+		drop
+		ret
+	consumer:
+		ipush 0
+	receive:
+		gload 0
+		chrecv
+		put
+		iinc 1
+		dup
+		jumpl 3 receive
+		drop
+		ret
+	main:	chnew 1
+		gstore 0
+		spawn consumer
+		spawn producer
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the consumer waits for the first value, then the producer
+	// waits for each value to be received before sending the next
+	if out != "s1s2s3" {
+		t.Fatalf("expected the values to be handed off in order, got %q", out)
+	}
+}
+
+func TestChannelDeadlock(t *testing.T) {
+	tests := map[string]string{
+		"receive":      "chnew 1\nchrecv",
+		"send to full": "chnew 1\ndup\nipush 1\nchsend\nipush 2\nchsend",
+		"coroutines": `
+			jump main
+		wait:	gload 0
+			chrecv
+			ret
+		main:	chnew 1
+			gstore 0
+			spawn wait
+			spawn wait
+			gload 0
+			chrecv
+		`,
+	}
+	for name, src := range tests {
+		_, err := runSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), "deadlock") {
+			t.Fatalf("%s: expected a deadlock, got %v", name, err)
+		}
+	}
+}
@@ -6,25 +6,71 @@ import (
 	"fmt"
 	"github.com/explodes/go-crust"
 	"io"
+	"flag"
+	"strings"
 )
 
+var (
+	checked     = flag.Bool("checked", false, "fail with an error on integer overflow instead of wrapping")
+	strict      = flag.Bool("strict", false, "allow one instruction per line and jump to source line numbers")
+	typecheck   = flag.Bool("typecheck", false, "check the kinds of values consumed by instructions before running")
+	includePath stringList
+	defines     stringList
+)
+
+func init() {
+	flag.Var(&includePath, "I", "directory to search for included files, may be repeated")
+	flag.Var(&defines, "D", "symbol to define for conditional assembly, may be repeated")
+}
+
+// stringList is a flag that collects every value it is given
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		if err := formatCommand(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	}
+
+	flag.Parse()
 
-	if len(os.Args) != 2 {
+	if flag.NArg() != 1 {
 		exitWith(errors.New("program file not specified"))
 	}
 
-	program, err := crust.NewProgramFromFile(os.Args[1])
+	program, err := crust.NewProgramFromFile(flag.Arg(0),
+		crust.WithIncludePath(includePath...),
+		crust.WithDefines(defines...),
+		crust.WithStrictLines(*strict),
+	)
 	if err != nil {
 		exitWith(errors.Wrap(err, "unable to run program"))
 	}
 
-	interpreter := crust.NewInterpreter(program, crust.EnableDebug(false))
+	interpreter := crust.NewInterpreter(program,
+		crust.EnableDebug(false),
+		crust.WithCheckedArithmetic(*checked),
+		crust.WithTypeCheck(*typecheck),
+	)
 	if err := interpreter.Run(); err != nil {
 		if err != io.EOF {
 			exitWithCode(2, err)
 		}
 	}
+	if code := interpreter.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
 }
 
 func exitWith(err error) {
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/explodes/go-crust"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+)
+
+// formatCommand runs the fmt subcommand, which formats the named
+// files, or standard input if there are none, to standard output
+func formatCommand(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the source file instead of standard output")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			return errors.New("cannot use -w with standard input")
+		}
+		return crust.FormatSource(os.Stdout, os.Stdin)
+	}
+	for _, path := range flags.Args() {
+		if err := formatFile(path, *write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFile formats the file at path to standard output, or back to the file if write is set
+func formatFile(path string, write bool) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read source file")
+	}
+	var out bytes.Buffer
+	if err := crust.FormatSource(&out, bytes.NewReader(src)); err != nil {
+		return errors.Wrapf(err, "unable to format %s", path)
+	}
+	if !write {
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
+	}
+	if bytes.Equal(src, out.Bytes()) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to stat source file")
+	}
+	if err := ioutil.WriteFile(path, out.Bytes(), info.Mode().Perm()); err != nil {
+		return errors.Wrap(err, "unable to write source file")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// EliminateDeadCode returns a copy of the program without the instructions
+// that can never run: those following an unconditional jump, halt, ret or throw
+// that no instruction jumps to, and procedures that are never called. Code is
+// live if it can be reached from the entry point or from an exported symbol,
+// following jumps, exception handlers and the procedures of live calls, cpush
+// and spawn instructions. Line numbers are kept, and lines that only held
+// removed instructions start at the next instruction that is kept. A program
+// that jumps with jumpd can move to any line, so it is returned unchanged. It
+// returns an error if the program fails Verify.
+func EliminateDeadCode(program *Program) (*Program, error) {
+	cfg, err := AnalyzeCFG(program)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to eliminate dead code")
+	}
+	live := program.liveBlocks(cfg)
+	if live == nil {
+		return program.copy(), nil
+	}
+	edits := make(map[int][]interface{})
+	for _, block := range cfg.Blocks {
+		if !live[block.Index] {
+			for ip := block.Start; ip < block.End; {
+				edits[ip] = nil
+				ip += 1 + len(instructionSignatures()[opMnemonics()[program.instructions[ip].(OpCode)]].args)
+			}
+		}
+	}
+	return program.rewrite(edits), nil
+}
+
+// liveBlocks reports, by block index, whether the blocks of the program's
+// control flow graph can run. It returns nil if every block can, because the
+// program jumps to lines computed at runtime.
+func (p *Program) liveBlocks(cfg *CFG) []bool {
+	live := make([]bool, len(cfg.Blocks))
+	var work []*BasicBlock
+	visit := func(ip int) {
+		if block, ok := cfg.BlockAt(ip); ok && !live[block.Index] {
+			live[block.Index] = true
+			work = append(work, block)
+		}
+	}
+	visitLine := func(line int) {
+		if ip, ok := p.lineStart(line); ok {
+			visit(ip)
+		}
+	}
+	if cfg.Entry >= 0 {
+		visit(cfg.Blocks[cfg.Entry].Start)
+	}
+	for _, symbol := range p.symbols {
+		if !symbol.Extern {
+			visitLine(symbol.Line)
+		}
+	}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, index := range block.Successors {
+			visit(cfg.Blocks[index].Start)
+		}
+		for ip := block.Start; ip < block.End; {
+			op := p.instructions[ip].(OpCode)
+			switch op {
+			case OpCall, OpTailCall, OpSpawn, OpCpush:
+				visitLine(p.instructions[ip+1].(int))
+			case OpJumpDynamic:
+				return nil
+			}
+			ip += 1 + len(instructionSignatures()[opMnemonics()[op]].args)
+		}
+	}
+	return live
+}
+
+// copy returns a program with the same contents that shares no slices with p
+func (p *Program) copy() *Program {
+	return &Program{
+		instructions: append([]interface{}{}, p.instructions...),
+		jumpTable:    append([]int{}, p.jumpTable...),
+		marks:        append([]sourceMark{}, p.marks...),
+		constants:    append([]interface{}{}, p.constants...),
+		symbols:      append([]Symbol{}, p.symbols...),
+		entry:        p.entry,
+		ast:          append([]Instruction{}, p.ast...),
+		sourceMap:    append([]sourcePosition{}, p.sourceMap...),
+		labels:       append([]labelDefinition{}, p.labels...),
+	}
+}
@@ -0,0 +1,48 @@
+package crust
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diagnostic is a problem found in a program without running it
+type Diagnostic struct {
+	// IP is the position of the instruction with the problem and Line is its 1-based line number
+	IP   int
+	Line int
+
+	// Position is where the instruction was written, zero if the program was not parsed from source
+	Position Position
+
+	Message string
+
+	// Rule is the name of the lint rule that found the problem, empty if it was not found by Lint
+	Rule string
+}
+
+func (d Diagnostic) String() string {
+	message := d.Message
+	if d.Rule != "" {
+		message += " (" + d.Rule + ")"
+	}
+	if d.Position.Line > 0 {
+		return fmt.Sprintf("%v: %s", d.Position, message)
+	}
+	return fmt.Sprintf("line %d: %s", d.Line, message)
+}
+
+// diagnostic returns a Diagnostic for the instruction at ip
+func (p *Program) diagnostic(ip int, format string, args ...interface{}) Diagnostic {
+	d := Diagnostic{IP: ip, Line: p.lineOf(ip), Message: fmt.Sprintf(format, args...)}
+	if pos, ok := p.PositionOf(ip); ok {
+		d.Position = pos
+	}
+	return d
+}
+
+// sortDiagnostics orders diagnostics by the position of their instruction
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(a, b int) bool {
+		return diagnostics[a].IP < diagnostics[b].IP
+	})
+}
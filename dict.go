@@ -0,0 +1,44 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// dict is a mutable map keyed by strings or ints.
+// Dicts are shared by reference when copied on the stack.
+type dict struct {
+	values map[interface{}]interface{}
+}
+
+func newDict() *dict {
+	return &dict{values: make(map[interface{}]interface{})}
+}
+
+func (d *dict) String() string {
+	parts := make([]string, 0, len(d.values))
+	for key, value := range d.values {
+		parts = append(parts, fmt.Sprintf("%v:%v", key, value))
+	}
+	sort.Strings(parts)
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func (d *dict) get(key interface{}) (interface{}, error) {
+	value, ok := d.values[key]
+	if !ok {
+		return nil, errors.Errorf("map key %v not found", key)
+	}
+	return value, nil
+}
+
+// asDictKey validates that v can be used as a map key
+func asDictKey(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case string, int:
+		return v, nil
+	}
+	return nil, errors.Errorf("value not a valid map key: %v", v)
+}
@@ -0,0 +1,288 @@
+package crust
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// lineText renders the instruction at the given 1-based line number
+// back into its textual assembly form
+func (p *Program) lineText(line int) (string, error) {
+	index := line - 1
+	if index < 0 || index >= len(p.jumpTable) {
+		return "", errors.Errorf("invalid line %d", line)
+	}
+	start := p.jumpTable[index]
+	end := len(p.instructions)
+	if index+1 < len(p.jumpTable) {
+		end = p.jumpTable[index+1]
+	}
+	if start >= end {
+		return "", errors.Errorf("line %d has no instructions", line)
+	}
+
+	op, ok := p.instructions[start].(OpCode)
+	if !ok {
+		return "", errors.Errorf("invalid program, not an op code: %v", p.instructions[start])
+	}
+	mnemonic, ok := opMnemonics()[op]
+	if !ok {
+		return "", errors.Errorf("invalid op code: %v", op)
+	}
+
+	parts := make([]string, 0, end-start)
+	parts = append(parts, mnemonic)
+	for _, arg := range p.instructions[start+1 : end] {
+		parts = append(parts, formatArg(arg))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// formatArg renders an instruction argument as it would be written in assembly
+func formatArg(arg interface{}) string {
+	switch value := arg.(type) {
+	case string:
+		return quoteString(value)
+	case []int:
+		parts := make([]string, 0, 1+len(value))
+		parts = append(parts, fmt.Sprint(len(value)))
+		for _, v := range value {
+			parts = append(parts, fmt.Sprint(v))
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprint(arg)
+}
+
+// quoteString renders a string argument so that it reads back as a single
+// token, quoting it only if it would not otherwise
+func quoteString(s string) string {
+	plain := s != ""
+	for index, c := range s {
+		if unicode.IsSpace(c) || !unicode.IsPrint(c) || isCommentStart(c) || (index == 0 && (c == '"' || c == '\'')) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return s
+	}
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, c := range s {
+		if escape, ok := unescapes[c]; ok && c != '\'' {
+			quoted.WriteByte('\\')
+			quoted.WriteRune(escape)
+			continue
+		}
+		quoted.WriteRune(c)
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// unescapes is the reverse of escapes, mapping characters to the
+// character that follows a backslash to write them in a literal
+var unescapes = make(map[rune]rune, len(escapes))
+
+func init() {
+	for escaped, c := range escapes {
+		unescapes[c] = escaped
+	}
+}
+
+// dataKind returns the type a constant is declared with in a .data section
+func dataKind(value interface{}) (string, bool) {
+	switch value.(type) {
+	case int:
+		return "int", true
+	case string:
+		return "string", true
+	case float64:
+		return "float", true
+	case bool:
+		return "bool", true
+	case *big.Int:
+		return "bigint", true
+	}
+	return "", false
+}
+
+// Disassemble writes the program as assembly that parses back into an
+// equivalent program, one instruction per line. Line number arguments are
+// written as labels, named after the program's exported symbols where it has
+// them. Line numbers the program computes at runtime, such as those pushed for
+// jumpd, are kept only if every line of the program holds one instruction.
+func (p *Program) Disassemble(w io.Writer) error {
+	labels, err := p.disassemblyLabels()
+	if err != nil {
+		return err
+	}
+	lineLabel := func(line int) string {
+		if line >= 1 && line <= len(p.jumpTable) {
+			if name, ok := labels[p.jumpTable[line-1]]; ok {
+				return name
+			}
+		}
+		return fmt.Sprint(line)
+	}
+
+	out := bufio.NewWriter(w)
+	for _, symbol := range p.symbols {
+		if !symbol.Extern {
+			fmt.Fprintf(out, ".export %s\n", lineLabel(symbol.Line))
+		}
+	}
+	if p.entry != 0 {
+		fmt.Fprintf(out, ".start %s\n", lineLabel(p.entry))
+	}
+	if len(p.constants) > 0 {
+		fmt.Fprintln(out, ".data")
+		for index, value := range p.constants {
+			kind, ok := dataKind(value)
+			if !ok {
+				return errors.Errorf("invalid constant %d: %v", index, value)
+			}
+			fmt.Fprintf(out, "%s %s\n", kind, formatArg(value))
+		}
+		fmt.Fprintln(out, ".text")
+	}
+
+	marks := p.marks
+	err = p.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		for len(marks) > 0 && marks[0].ip <= ip {
+			fmt.Fprintf(out, ".line %s %d\n", quoteString(marks[0].file), marks[0].line)
+			marks = marks[1:]
+		}
+		if name, ok := labels[ip]; ok {
+			fmt.Fprintf(out, "%s:\n", name)
+		}
+		parts := []string{opMnemonics()[op]}
+		for index, argType := range signature.args {
+			arg := p.instructions[ip+1+index]
+			switch value := arg.(type) {
+			case int:
+				if argType == ArgLine {
+					parts = append(parts, lineLabel(value))
+					continue
+				}
+			case []int:
+				if op == OpJumpTable {
+					parts = append(parts, fmt.Sprint(len(value)))
+					for _, line := range value {
+						parts = append(parts, lineLabel(line))
+					}
+					continue
+				}
+			}
+			parts = append(parts, formatArg(arg))
+		}
+		fmt.Fprintf(out, "\t%s\n", strings.Join(parts, " "))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if name, ok := labels[len(p.instructions)]; ok {
+		// a label past the last instruction ends the program, which a nop keeps doing
+		fmt.Fprintf(out, "%s:\n\tnop\n", name)
+	}
+	return out.Flush()
+}
+
+// disassemblyLabels names the instruction positions that line number arguments,
+// exported symbols and the entry point refer to, after the line each instruction
+// is written on by Disassemble
+func (p *Program) disassemblyLabels() (map[int]string, error) {
+	targets := make(map[int]bool)
+	addLine := func(line int) {
+		if line >= 1 && line <= len(p.jumpTable) {
+			targets[p.jumpTable[line-1]] = true
+		}
+	}
+	ordinals := make(map[int]int)
+	err := p.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		ordinals[ip] = len(ordinals) + 1
+		for index, argType := range signature.args {
+			switch value := p.instructions[ip+1+index].(type) {
+			case int:
+				if argType == ArgLine {
+					addLine(value)
+				}
+			case []int:
+				if op == OpJumpTable {
+					for _, line := range value {
+						addLine(line)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ordinals[len(p.instructions)] = len(ordinals) + 1
+	addLine(p.entry)
+
+	labels := make(map[int]string)
+	names := make(map[string]bool)
+	for _, symbol := range p.symbols {
+		if symbol.Extern || symbol.Line < 1 || symbol.Line > len(p.jumpTable) {
+			continue
+		}
+		ip := p.jumpTable[symbol.Line-1]
+		if _, ok := labels[ip]; !ok {
+			labels[ip] = symbol.Name
+			names[symbol.Name] = true
+		}
+	}
+	ips := make([]int, 0, len(targets))
+	for ip := range targets {
+		ips = append(ips, ip)
+	}
+	sort.Ints(ips)
+	for _, ip := range ips {
+		if _, ok := labels[ip]; ok {
+			continue
+		}
+		name := fmt.Sprintf("L%d", ordinals[ip])
+		for names[name] {
+			name += "_"
+		}
+		labels[ip] = name
+		names[name] = true
+	}
+	return labels, nil
+}
+
+// decode calls fn with each instruction of the program in order,
+// returning an error if the instructions are not a valid sequence of
+// op codes each followed by their arguments
+func (p *Program) decode(fn func(ip int, op OpCode, signature instructionSignature) error) error {
+	for ip := 0; ip < len(p.instructions); {
+		op, ok := p.instructions[ip].(OpCode)
+		if !ok {
+			return errors.Errorf("invalid program, not an op code at ip %d: %v", ip, p.instructions[ip])
+		}
+		mnemonic, ok := opMnemonics()[op]
+		if !ok {
+			return errors.Errorf("invalid op code at ip %d: %v", ip, op)
+		}
+		signature := instructionSignatures()[mnemonic]
+		if ip+1+len(signature.args) > len(p.instructions) {
+			return errors.Errorf("invalid program, %s at ip %d is missing arguments", mnemonic, ip)
+		}
+		if err := fn(ip, op, signature); err != nil {
+			return err
+		}
+		ip += 1 + len(signature.args)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// WithEntryPoint starts the program at the 1-based line number instead of the
+// entry point declared by its .start directive. A line of 0 keeps the program's own.
+func WithEntryPoint(line int) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.entry = line
+	}
+}
+
+// EntryPoint returns the 1-based line number declared by the program's .start
+// directive, or 0 if it starts at its first instruction
+func (p *Program) EntryPoint() int {
+	return p.entry
+}
+
+// enter moves the interpreter to the line its program starts at
+func (i *Interpreter) enter() {
+	line := i.program.entry
+	if i.entry != 0 {
+		line = i.entry
+	}
+	if line == 0 {
+		return
+	}
+	ip, err := i.lineIP(line)
+	if err != nil {
+		i.startErr = errors.Wrapf(err, "invalid entry point %d", line)
+		return
+	}
+	i.ip = ip
+}
+
+// parseStart reads the line number or label named by a .start directive
+func parseStart(in *parser) error {
+	if in.start != nil {
+		return errors.New("duplicate .start directive")
+	}
+	line, err := nextLine(in)
+	if err != nil {
+		return err
+	}
+	in.start = line
+	in.startPos = in.Position()
+	return nil
+}
+
+// resolveStart sets the program's entry point to the line named by its .start directive
+func resolveStart(in *parser, program *Program) error {
+	if in.start == nil {
+		return nil
+	}
+	var line int
+	switch start := in.start.(type) {
+	case int:
+		line = start
+	case labelRef:
+		var ok bool
+		if line, ok = in.labels[start.name]; !ok {
+			return &ParseError{
+				Position: start.pos,
+				Token:    start.name,
+				Err:      errors.Errorf("undefined label %s", start.name),
+			}
+		}
+	}
+	if line < 1 || line > len(program.jumpTable) {
+		return &ParseError{
+			Position: in.startPos,
+			Err:      errors.Errorf("entry point %d is not a line of the program", line),
+		}
+	}
+	program.entry = line
+	return nil
+}
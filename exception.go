@@ -0,0 +1,86 @@
+package crust
+
+import (
+	"fmt"
+)
+
+// handler is an entry on the exception handler stack installed by try
+type handler struct {
+	// catchIP is the instruction pointer to resume at when an exception is caught
+	catchIP int
+
+	// depth is the stack depth to unwind to when an exception is caught
+	depth int
+
+	// frames is the call stack depth to unwind to when an exception is caught
+	frames int
+}
+
+// thrownError is the error produced by a throw instruction
+// that is not caught by any handler
+type thrownError struct {
+	value interface{}
+}
+
+func (e *thrownError) Error() string {
+	return fmt.Sprintf("uncaught exception: %v", e.value)
+}
+
+// uncatchableError is an error that stops the program even inside a try,
+// such as a deadlock, an error returned by a breakpoint handler or a sleep
+// interrupted by the interpreter's context
+type uncatchableError struct {
+	err error
+}
+
+func (e *uncatchableError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error that stopped the program
+func (e *uncatchableError) Cause() error {
+	return e.err
+}
+
+// catch transfers control to the most recent exception handler, unwinding the
+// stack and call stack to their depths when the handler was installed and pushing
+// the exception value. Thrown values are pushed as-is, other runtime errors are
+// pushed as their message. If there is no handler or err is uncatchable, err is
+// returned unchanged.
+// Handlers of calls that have returned are discarded, and the stack is never grown
+// back to a depth that values have already been popped from.
+func (i *Interpreter) catch(err error) error {
+	if _, ok := err.(*uncatchableError); ok {
+		return err
+	}
+	i.dropHandlers(len(i.frames))
+	if len(i.handlers) == 0 {
+		return err
+	}
+	var h handler
+	h, i.handlers = i.handlers[len(i.handlers)-1], i.handlers[:len(i.handlers)-1]
+
+	var value interface{} = err.Error()
+	if thrown, ok := err.(*thrownError); ok {
+		value = thrown.value
+	}
+
+	if h.depth < len(i.stack) {
+		i.stack = i.stack[:h.depth]
+	}
+	i.frames = i.frames[:h.frames]
+	i.push(value)
+	i.ip = h.catchIP
+	i.dlog("catch %v => %d", value, i.ip)
+	return nil
+}
+
+// dropHandlers discards the handlers installed by calls deeper than frames,
+// which can no longer catch exceptions once those calls have returned
+func (i *Interpreter) dropHandlers(frames int) {
+	n := len(i.handlers)
+	for n > 0 && i.handlers[n-1].frames > frames {
+		n--
+	}
+	i.handlers = i.handlers[:n]
+}
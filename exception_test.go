@@ -0,0 +1,115 @@
+package crust
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatchDoesNotGrowStack(t *testing.T) {
+	out, err := runSource(t, `
+		ipush 1
+		ipush 2
+		try handler
+		drop
+		drop
+		spush "x"
+		throw
+	handler:
+		depth
+		put
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1" {
+		t.Fatalf("expected the stack to hold only the exception, got depth %s", out)
+	}
+}
+
+func TestHandlersAreDroppedOnReturn(t *testing.T) {
+	tests := map[string]string{
+		"ret": `
+			call install
+			spush "boom"
+			throw
+		install:
+			try handler
+			ret
+		handler:
+			spush "caught"
+			put
+			ret
+		`,
+		"tcall": `
+			call install
+			spush "boom"
+			throw
+		install:
+			try handler
+			tcall done
+		handler:
+			spush "caught"
+			put
+			ret
+		done:
+			ret
+		`,
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runSource(t, src)
+			if out != "" {
+				t.Fatalf("expected the handler of a returned call not to run, got output %q", out)
+			}
+			if err == nil || !strings.Contains(err.Error(), "uncaught exception: boom") {
+				t.Fatalf("expected an uncaught exception, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUncatchableErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tests := map[string]struct {
+		body string
+		opts []InterpreterOption
+		want string
+	}{
+		"deadlock": {
+			body: "chnew 1\nchrecv",
+			want: "deadlock",
+		},
+		"breakpoint handler": {
+			body: "brk",
+			opts: []InterpreterOption{WithBreakpointHandler(func(line int) error { return errStop })},
+			want: "stop",
+		},
+		"interrupted sleep": {
+			body: "sleep 10000",
+			opts: []InterpreterOption{WithContext(ctx)},
+			want: "sleep interrupted",
+		},
+	}
+	for name, test := range tests {
+		out, err := runSource(t, "try handler\n"+test.body+"\nhalt 0\nhandler: spush \"caught\"\nput", test.opts...)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%s: expected the error to stop the program, got %v", name, err)
+		}
+		if out != "" {
+			t.Fatalf("%s: expected the error not to be caught, got %q", name, out)
+		}
+	}
+	program, err := NewProgramFromReader(strings.NewReader("try handler\nbrk\nhandler: nop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewInterpreter(program, WithBreakpointHandler(func(line int) error { return errStop })).Run()
+	if errors.Cause(err) != errStop {
+		t.Fatalf("expected the breakpoint handler's error as the cause, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package crust
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Filesystem is the file storage available to file instructions
+type Filesystem interface {
+	// ReadFile returns the contents of the file at path
+	ReadFile(path string) ([]byte, error)
+
+	// WriteFile replaces the contents of the file at path, creating it if necessary
+	WriteFile(path string, data []byte) error
+}
+
+// FilePermission is a set of file operations a program is allowed to perform
+type FilePermission int
+
+const (
+	// FileRead allows programs to read files with fread
+	FileRead FilePermission = 1 << iota
+
+	// FileWrite allows programs to write files with fwrite
+	FileWrite
+)
+
+// DirFilesystem is a Filesystem rooted at a directory on disk.
+// Paths are resolved relative to the directory and cannot escape it.
+type DirFilesystem string
+
+func (d DirFilesystem) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(d.resolve(path))
+}
+
+func (d DirFilesystem) WriteFile(path string, data []byte) error {
+	return ioutil.WriteFile(d.resolve(path), data, 0644)
+}
+
+func (d DirFilesystem) resolve(path string) string {
+	return filepath.Join(string(d), filepath.Clean("/"+path))
+}
@@ -0,0 +1,49 @@
+package crust
+
+// lineStart returns the instruction position of the 1-based line number, false if there is no such line
+func (p *Program) lineStart(line int) (int, bool) {
+	if line < 1 || line > len(p.jumpTable) {
+		return 0, false
+	}
+	return p.jumpTable[line-1], true
+}
+
+// flowOf returns the instruction positions that control can jump to from the
+// instruction op at ip, and whether it can continue to the next instruction.
+// Calls continue to the next instruction and do not jump, and the handler
+// installed by try is a jump target. Instructions that leave the current call
+// or move to a line computed at runtime have no targets and do not continue.
+func (p *Program) flowOf(ip int, op OpCode) (targets []int, continues bool) {
+	args := p.instructions[ip+1:]
+	lineTarget := func(line int) {
+		if target, ok := p.lineStart(line); ok {
+			targets = append(targets, target)
+		}
+	}
+	switch op {
+	case OpJump:
+		lineTarget(args[0].(int))
+		return targets, false
+	case OpJumpLessThan, OpJumpEqual, OpJumpNotEqual, OpJumpGreaterThan, OpJumpGreaterEqual, OpJumpLessEqual:
+		lineTarget(args[1].(int))
+		return targets, true
+	case OpJumpZero, OpJumpNotZero, OpJnil, OpTry:
+		lineTarget(args[0].(int))
+		return targets, true
+	case OpJumpTable:
+		for _, line := range args[0].([]int) {
+			lineTarget(line)
+		}
+		lineTarget(args[1].(int))
+		return targets, false
+	case OpJrel:
+		lineTarget(p.lineOf(ip) + args[0].(int))
+		return targets, false
+	case OpJrell:
+		lineTarget(p.lineOf(ip) + args[1].(int))
+		return targets, true
+	case OpJumpDynamic, OpHalt, OpReturn, OpThrow:
+		return nil, false
+	}
+	return nil, true
+}
@@ -0,0 +1,18 @@
+package crust
+
+// countVerbs returns the number of printf-style verbs in format
+// that consume an argument. Escaped percent signs (%%) are not counted.
+func countVerbs(format string) int {
+	count := 0
+	for index := 0; index < len(format); index++ {
+		if format[index] != '%' {
+			continue
+		}
+		index++
+		if index < len(format) && format[index] == '%' {
+			continue
+		}
+		count++
+	}
+	return count
+}
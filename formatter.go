@@ -0,0 +1,277 @@
+package crust
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// formatIndent is the column instructions are indented to
+const formatIndent = 8
+
+// sourceLine is a line of crust source split into the parts that FormatSource lays out
+type sourceLine struct {
+	// labels are the labels defined at the start of the line, separated by spaces
+	labels string
+
+	// head is the instruction or directive following the labels
+	// and operands are the tokens following it, separated by spaces
+	head     string
+	operands string
+
+	// comment is the comment ending the line, if any,
+	// and indented is whether a comment alone on its line was indented
+	comment  string
+	indented bool
+
+	// multiline is set when the line holds a literal that continues onto
+	// the following lines, which are written as part of it
+	multiline bool
+
+	// continued is set on the lines taken up by a literal started on an earlier line
+	continued bool
+}
+
+// FormatSource writes crust source read from r to w in its canonical layout.
+// Labels start their line, instructions are indented and their operands and
+// trailing comments are aligned with those of the surrounding lines. Tokens are
+// separated by single spaces and comments are kept. Lines are never added or
+// removed, so line numbers are unchanged, and formatting is idempotent.
+func FormatSource(w io.Writer, r io.Reader) error {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to read source")
+	}
+	lines, err := splitSource(string(src))
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	for start := 0; start < len(lines); {
+		end := start + 1
+		if !lines[start].blank() {
+			for end < len(lines) && !lines[end].blank() {
+				end++
+			}
+		}
+		writeBlock(out, lines[start:end])
+		start = end
+	}
+	return out.Flush()
+}
+
+// blank reports whether the line has nothing on it
+func (l *sourceLine) blank() bool {
+	return !l.continued && l.labels == "" && l.head == "" && l.comment == ""
+}
+
+// aligned reports whether the line's operands are aligned with the lines around it,
+// which they are unless it is a directive or its labels push it past the indent
+func (l *sourceLine) aligned() bool {
+	return !l.multiline && l.operands != "" && l.codeColumn() == formatIndent
+}
+
+// codeColumn returns the column the line's head is written at
+func (l *sourceLine) codeColumn() int {
+	if l.labels == "" {
+		if strings.HasPrefix(l.head, ".") {
+			return 0
+		}
+		return formatIndent
+	}
+	if column := width(l.labels) + 1; column > formatIndent || strings.HasPrefix(l.head, ".") {
+		return column
+	}
+	return formatIndent
+}
+
+// writeBlock writes a run of lines without blank lines between them,
+// aligning their operands and comments
+func writeBlock(out *bufio.Writer, lines []sourceLine) {
+	operandColumn := 0
+	for _, line := range lines {
+		if line.aligned() {
+			operandColumn = larger(operandColumn, line.codeColumn()+width(line.head)+1)
+		}
+	}
+	code := make([]string, len(lines))
+	commentColumn := 0
+	for index, line := range lines {
+		code[index] = line.code(operandColumn)
+		if line.comment != "" && code[index] != "" && !line.multiline {
+			commentColumn = larger(commentColumn, width(code[index])+1)
+		}
+	}
+	for index, line := range lines {
+		if line.continued {
+			continue
+		}
+		text := code[index]
+		switch {
+		case line.comment == "":
+		case text == "" && line.indented:
+			text = strings.Repeat(" ", formatIndent) + line.comment
+		case text == "":
+			text = line.comment
+		case line.multiline:
+			text += " " + line.comment
+		default:
+			text = pad(text, commentColumn) + line.comment
+		}
+		out.WriteString(text)
+		out.WriteByte('\n')
+	}
+}
+
+// code returns the line without its comment, with operands aligned at operandColumn
+func (l *sourceLine) code(operandColumn int) string {
+	if l.head == "" {
+		return l.labels
+	}
+	text := pad(l.labels, l.codeColumn()) + l.head
+	switch {
+	case l.operands == "":
+		return text
+	case l.aligned():
+		return pad(text, operandColumn) + l.operands
+	default:
+		return text + " " + l.operands
+	}
+}
+
+// pad returns text followed by spaces up to column, or by a single space
+// if it already reaches column. Empty text is padded without the space.
+func pad(text string, column int) string {
+	if text != "" && width(text) >= column {
+		return text + " "
+	}
+	return text + strings.Repeat(" ", column-width(text))
+}
+
+// width returns the number of columns text takes up
+func width(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// larger returns the larger of a and b
+func larger(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// splitSource splits source into its lines, splitting each line into tokens
+// the same way the lexer does but keeping literals and comments as written
+func splitSource(src string) ([]sourceLine, error) {
+	src = strings.TrimSuffix(src, "\n")
+	if src == "" {
+		return nil, nil
+	}
+	lines := make([]sourceLine, strings.Count(src, "\n")+1)
+
+	// owner is the line the tokens being read belong to, which is the
+	// line being read unless a literal continued onto it from an earlier one
+	lineNumber, owner, lineStart := 0, 0, 0
+	var tokens []string
+	for index := 0; index < len(src); {
+		c, size := utf8.DecodeRuneInString(src[index:])
+		switch {
+		case c == '\n':
+			lines[owner].setTokens(tokens)
+			tokens = nil
+			lineNumber++
+			owner = lineNumber
+			lineStart = index + 1
+			index++
+			continue
+		case unicode.IsSpace(c):
+			index += size
+			continue
+		}
+
+		start := index
+		switch {
+		case isCommentStart(c):
+			end := strings.IndexByte(src[index:], '\n')
+			if end < 0 {
+				end = len(src) - index
+			}
+			index += end
+			lines[owner].comment = strings.TrimRightFunc(src[start:index], unicode.IsSpace)
+			lines[owner].indented = start > lineStart
+			continue
+		case c == '"' || c == '\'':
+			end, err := quotedEnd(src, index)
+			if err != nil {
+				return nil, &ParseError{
+					Position: Position{Line: lineNumber + 1, Column: width(src[lineStart:start]) + 1},
+					Err:      err,
+				}
+			}
+			index = end
+		default:
+			for index < len(src) {
+				c, size := utf8.DecodeRuneInString(src[index:])
+				if unicode.IsSpace(c) || isCommentStart(c) {
+					break
+				}
+				index += size
+			}
+		}
+
+		token := src[start:index]
+		tokens = append(tokens, token)
+		if newlines := strings.Count(token, "\n"); newlines > 0 {
+			lines[owner].multiline = true
+			for n := 1; n <= newlines; n++ {
+				lines[lineNumber+n].continued = true
+			}
+			lineNumber += newlines
+			lineStart = start + strings.LastIndexByte(token, '\n') + 1
+		}
+	}
+	lines[owner].setTokens(tokens)
+	return lines, nil
+}
+
+// setTokens divides the tokens of a line, other than its comment,
+// into its labels, head and operands
+func (l *sourceLine) setTokens(tokens []string) {
+	labels := 0
+	for labels < len(tokens) && isLabelToken(tokens[labels]) {
+		labels++
+	}
+	l.labels = strings.Join(tokens[:labels], " ")
+	if labels < len(tokens) {
+		l.head = tokens[labels]
+		l.operands = strings.Join(tokens[labels+1:], " ")
+	}
+}
+
+// isLabelToken reports whether token defines a label
+func isLabelToken(token string) bool {
+	return len(token) > 1 && strings.HasSuffix(token, ":") && token[0] != '"' && token[0] != '\''
+}
+
+// quotedEnd returns the index just past the closing quote of the
+// literal whose opening quote is at start, skipping escaped characters
+func quotedEnd(src string, start int) (int, error) {
+	quote := src[start]
+	for index := start + 1; index < len(src); index++ {
+		switch src[index] {
+		case quote:
+			return index + 1, nil
+		case '\\':
+			index++
+		}
+	}
+	if quote == '"' {
+		return 0, errors.New("unterminated string literal")
+	}
+	return 0, errors.New("unterminated character literal")
+}
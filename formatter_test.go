@@ -0,0 +1,87 @@
+package crust
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// formatSources are programs written without regard for layout
+var formatSources = map[string]string{
+	"comments": "# a program\nstart:   ipush 0   ; counter\nloop: iinc    1\n  dup\n      put\n   dup   jumpl 3 loop  # again\n",
+	"quotes":   "spush \"a # not ; a comment\"\n put\n  spush   \"  spaced\\t\\\"quoted\\\"  \"   put\nipush 'a'   \n   put\n ipush ';' put ipush '#' put\n",
+	"directives": `.const LIMIT 3
+.macro show value
+  spush value
+     put
+.endmacro
+.data
+ string "data"
+   int 0x10
+.text
+ loadc 0
+  show "\"done\"\n"
+   loadc 1 ipush LIMIT iadd put
+ call helper
+ halt 0
+.proc helper
+helper_body: spush "  helper  "
+  put
+  ret
+.endproc
+`,
+}
+
+func formatString(t *testing.T, src string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := FormatSource(&out, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestFormatSource(t *testing.T) {
+	want := `# a program
+start:  ipush 0            ; counter
+loop:   iinc  1
+        dup
+        put
+        dup   jumpl 3 loop # again
+`
+	if got := formatString(t, formatSources["comments"]); got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestFormatSourceRoundTrip(t *testing.T) {
+	for name, src := range formatSources {
+		formatted := formatString(t, src)
+		if again := formatString(t, formatted); again != formatted {
+			t.Fatalf("%s: expected formatting to be idempotent, got\n%s\nthen\n%s", name, formatted, again)
+		}
+		if strings.Count(formatted, "\n") != strings.Count(src, "\n") {
+			t.Fatalf("%s: expected the lines to be kept, got\n%s", name, formatted)
+		}
+		var outputs, hashes []string
+		for _, text := range []string{src, formatted} {
+			program, err := NewProgramFromReader(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			hash, err := program.Hash()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var stdout bytes.Buffer
+			if err := NewInterpreter(program, WithStdout(&stdout)).Run(); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			outputs = append(outputs, stdout.String())
+			hashes = append(hashes, hash)
+		}
+		if outputs[0] != outputs[1] || hashes[0] != hashes[1] {
+			t.Fatalf("%s: expected the formatted program to be the same, printed %q and %q", name, outputs[0], outputs[1])
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package crust
+
+// Superinstructions are op codes that run a common sequence of instructions
+// at once. They never appear in programs: NewInterpreter fuses the
+// sequences of the instructions Run runs, replacing the op code of the first
+// instruction of a sequence and leaving the rest in place, so instruction
+// positions, line starts and jumps into the middle of a sequence are unchanged.
+// Step always runs a single instruction of the program.
+const (
+	opIpushIadd       = OpCode(20) // ipush value; iadd
+	opDupPut          = OpCode(29) // dup; put
+	opDupJumpLessThan = OpCode(30) // dup; jumpl value line, as at the end of counting loops
+)
+
+// superinstruction is a sequence of op codes fused into a superinstruction
+type superinstruction struct {
+	first  OpCode
+	second OpCode
+	fused  OpCode
+}
+
+var superinstructions = []superinstruction{
+	{OpIpush, OpIadd, opIpushIadd},
+	{OpDup, OpPut, opDupPut},
+	{OpDup, OpJumpLessThan, opDupJumpLessThan},
+}
+
+// fuse returns a copy of the program's instructions with the sequences of
+// superinstructions fused, or the instructions themselves if they are not well formed
+func fuse(program *Program) []interface{} {
+	code := append([]interface{}{}, program.instructions...)
+	var previous OpCode
+	previousIP := -1
+	err := program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		if previousIP >= 0 {
+			for _, s := range superinstructions {
+				if previous == s.first && op == s.second {
+					code[previousIP] = s.fused
+					break
+				}
+			}
+		}
+		previous, previousIP = op, ip
+		return nil
+	})
+	if err != nil {
+		return program.instructions
+	}
+	return code
+}
+
+// executeFused runs a superinstruction. When its instructions would not run
+// the simple way it handles, such as when they fail, it runs only the first
+// instruction, leaving the next Step to run the rest as usual.
+func (i *Interpreter) executeFused(fused, first OpCode) error {
+	n := len(i.stack)
+	switch fused {
+	case opIpushIadd:
+		value, ok := i.code[i.ip].(int)
+		if !ok || n == 0 {
+			break
+		}
+		top, ok := i.stack[n-1].(int)
+		if !ok || (i.checkedArithmetic && addOverflows(top, value)) {
+			break
+		}
+		i.stack[n-1] = top + value
+		i.ip += 2
+		i.dlog("ipush+iadd %d + %d = %d", top, value, top+value)
+		return nil
+	case opDupPut:
+		if n == 0 {
+			break
+		}
+		i.toStdout(i.stack[n-1])
+		i.ip++
+		i.dlog("dup+put %v", i.stack[n-1])
+		return nil
+	case opDupJumpLessThan:
+		value, ok := i.code[i.ip+1].(int)
+		line, isLine := i.code[i.ip+2].(int)
+		if !ok || !isLine || n == 0 {
+			break
+		}
+		top, ok := i.stack[n-1].(int)
+		if !ok {
+			break
+		}
+		i.ip += 3
+		if top < value {
+			i.jump(line)
+		}
+		i.dlog("dup+jump %d<%d ? %d => %d jumped=%v", top, value, line, i.ip, top < value)
+		return nil
+	}
+	return i.executeOp(first)
+}
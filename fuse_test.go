@@ -0,0 +1,57 @@
+package crust
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingLoop counts to a million, running each of the fused sequences on every iteration
+const countingLoop = `
+	ipush 0
+loop:
+	ipush 1
+	iadd
+	dup
+	jumpl 1000000 loop
+	dup
+	put
+`
+
+func TestStepRunsSingleInstructions(t *testing.T) {
+	program, err := NewProgramFromReader(strings.NewReader("ipush 1\nipush 2\niadd\ndup\nput"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter(program, WithStdout(ioutil.Discard))
+	for _, want := range [][]interface{}{{1}, {1, 2}, {3}, {3, 3}, {3}} {
+		if err := interpreter.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(interpreter.stack, want) {
+			t.Fatalf("expected stack %v, got %v", want, interpreter.stack)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	program, err := NewProgramFromReader(strings.NewReader(countingLoop))
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarks := map[string]bool{"fused": true, "unfused": false}
+	for name, fused := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				interpreter := NewInterpreter(program, WithStdout(ioutil.Discard))
+				if !fused {
+					interpreter.fused = program.instructions
+				}
+				if err := interpreter.Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
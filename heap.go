@@ -0,0 +1,83 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// reference is a value that refers to a cell allocated on the heap
+type reference int
+
+func (r reference) String() string {
+	return fmt.Sprintf("&%d", int(r))
+}
+
+// heap holds mutable cells that live independently of the stack.
+// Freed cells are recycled by later allocations.
+type heap struct {
+	// cells are every cell ever allocated, indexed by reference
+	cells []heapCell
+
+	// free are the references of released cells available for reuse
+	free []reference
+}
+
+type heapCell struct {
+	// value is the contents of the cell, nil until first stored
+	value interface{}
+
+	// allocated is false once the cell has been freed
+	allocated bool
+}
+
+// alloc allocates a new empty cell and returns its reference
+func (h *heap) alloc() reference {
+	if len(h.free) > 0 {
+		var ref reference
+		ref, h.free = h.free[len(h.free)-1], h.free[:len(h.free)-1]
+		h.cells[ref] = heapCell{allocated: true}
+		return ref
+	}
+	h.cells = append(h.cells, heapCell{allocated: true})
+	return reference(len(h.cells) - 1)
+}
+
+// release frees the cell so its reference may be reused
+func (h *heap) release(ref reference) error {
+	cell, err := h.cell(ref)
+	if err != nil {
+		return err
+	}
+	*cell = heapCell{}
+	h.free = append(h.free, ref)
+	return nil
+}
+
+// load returns the value stored in the cell
+func (h *heap) load(ref reference) (interface{}, error) {
+	cell, err := h.cell(ref)
+	if err != nil {
+		return nil, err
+	}
+	if cell.value == nil {
+		return nil, errors.Errorf("reference %v is not set", ref)
+	}
+	return cell.value, nil
+}
+
+// store replaces the value stored in the cell
+func (h *heap) store(ref reference, value interface{}) error {
+	cell, err := h.cell(ref)
+	if err != nil {
+		return err
+	}
+	cell.value = value
+	return nil
+}
+
+func (h *heap) cell(ref reference) (*heapCell, error) {
+	if ref < 0 || int(ref) >= len(h.cells) || !h.cells[ref].allocated {
+		return nil, errors.Errorf("invalid reference %v", ref)
+	}
+	return &h.cells[ref], nil
+}
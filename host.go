@@ -0,0 +1,66 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Value is a crust value passed between a program and the Go functions it calls.
+// Ints, strings, floats and bools are represented by int, string, float64 and bool.
+// Other values, such as arrays and maps, are opaque and may only be passed back to the program.
+// A nil Value returned to the program becomes crust's nil.
+type Value interface{}
+
+// HostFunc is a Go function callable from a program. It receives its arguments
+// in the order they were pushed and its results are pushed in order.
+type HostFunc func(args []Value) ([]Value, error)
+
+// RegisterHostFunc makes fn callable by name from hostcall instructions,
+// replacing any function previously registered under that name
+func (i *Interpreter) RegisterHostFunc(name string, fn HostFunc) {
+	i.hostFuncs[name] = fn
+}
+
+// callHostFunc consumes argc arguments from the stack, calls fn with them and
+// pushes its results
+func (i *Interpreter) callHostFunc(fn HostFunc, argc int) (args, results []Value, err error) {
+	if argc < 0 {
+		return nil, nil, errors.Errorf("invalid argument count %d", argc)
+	}
+	if err := i.requireDepth(argc); err != nil {
+		return nil, nil, err
+	}
+	base := len(i.stack) - argc
+	args = make([]Value, argc)
+	for index, value := range i.stack[base:] {
+		args[index] = value
+	}
+	i.stack = i.stack[:base]
+	results, err = fn(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, result := range results {
+		if result == nil {
+			result = nilValue{}
+		}
+		i.push(result)
+	}
+	return args, results, nil
+}
+
+// Syscall is an entry of the table used by sys instructions.
+// Its slot number in the table is the stable identifier programs refer to it by.
+type Syscall struct {
+	// Argc is the number of arguments consumed from the stack
+	Argc int
+
+	// Func is called with the arguments, nil for unassigned slots
+	Func HostFunc
+}
+
+// WithSyscalls sets the table that sys instructions dispatch through
+func WithSyscalls(table []Syscall) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.syscalls = table
+	}
+}
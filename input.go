@@ -0,0 +1,46 @@
+package crust
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"unicode"
+	"strings"
+)
+
+// readWord reads the next whitespace separated word from stdin
+func (i *Interpreter) readWord() (string, error) {
+	var word bytes.Buffer
+	for {
+		r, _, err := i.stdin.ReadRune()
+		if err == io.EOF {
+			if word.Len() > 0 {
+				return word.String(), nil
+			}
+			return "", errors.New("end of input")
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "unable to read input")
+		}
+		if unicode.IsSpace(r) {
+			if word.Len() > 0 {
+				return word.String(), nil
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+}
+
+// readLine reads the next line from stdin without its line ending
+func (i *Interpreter) readLine() (string, error) {
+	line, err := i.stdin.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", errors.New("end of input")
+		}
+	} else if err != nil {
+		return "", errors.Wrap(err, "unable to read input")
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
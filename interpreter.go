@@ -6,6 +6,16 @@ import (
 	"github.com/pkg/errors"
 	"os"
 	"log"
+	"reflect"
+	"unicode/utf8"
+	"strings"
+	"strconv"
+	"bufio"
+	"math/rand"
+	"time"
+	"context"
+	"math"
+	"math/big"
 )
 
 // Program is a parsed crust program
@@ -13,31 +23,175 @@ type Interpreter struct {
 	// program is the parsed crust program
 	program *Program
 
-	// ip is the current instruction pointer
-	ip int
+	// coroutine is the currently running execution context
+	*coroutine
 
-	// stack is the state of the program
-	stack []interface{}
+	// runQueue are the coroutines waiting to run, in the order they will resume
+	runQueue []*coroutine
+
+	// spawned is the number of coroutines spawned so far
+	spawned int
+
+	// globals are the global variable slots of the program, unset slots are nil
+	globals []interface{}
+
+	// variables are the named variables of the program
+	variables map[string]interface{}
+
+	// heap holds the cells referred to by reference values
+	heap heap
+
+	// memory is the flat memory used by mload and mstore instructions
+	memory []int
+
+	// checkedArithmetic makes integer instructions fail on overflow instead of wrapping
+	checkedArithmetic bool
+
+	// maxCallDepth is the number of nested calls allowed before
+	// the program is considered to have overflowed the call stack
+	maxCallDepth int
+
+	// rand is the random number generator used by rand instructions
+	rand *rand.Rand
+
+	// ctx cancels the program when done
+	ctx context.Context
+
+	// clock is the source of time for time instructions
+	clock Clock
+
+	// started is the time the interpreter was created, according to clock
+	started time.Time
+
+	// env is the environment visible to getenv instructions
+	env map[string]string
+
+	// fs is the file storage for file instructions, nil when file access is disabled
+	fs Filesystem
+
+	// filePerm is the set of file operations the program is allowed to perform
+	filePerm FilePermission
+
+	// hostFuncs are the Go functions callable by hostcall instructions
+	hostFuncs map[string]HostFunc
+
+	// instructionFuncs run the instructions registered with RegisterInstruction
+	instructionFuncs map[OpCode]instructionFunc
+
+	// syscalls is the table of Go functions callable by sys instructions
+	syscalls []Syscall
+
+	// onBreakpoint is called by brk instructions, nil to return ErrBreakpoint instead
+	onBreakpoint func(line int) error
+
+	// stdin is the source reader for reading input
+	stdin *bufio.Reader
 
 	// stdout is the destination writer for printing information
 	stdout io.Writer
 
+	// stderr is the destination writer for printing diagnostics
+	stderr io.Writer
+
 	debug bool
+
+	// entry is the 1-based line number set by WithEntryPoint, 0 to use the program's
+	entry int
+
+	// verify is whether NewInterpreter verifies the program
+	verify bool
+
+	// typeCheck is whether NewInterpreter checks the program with CheckTypes
+	typeCheck bool
+
+	// code is the instruction stream being run: the program's instructions
+	// when stepping, and fused when running
+	code []interface{}
+
+	// fused is the program's instructions with common sequences fused into
+	// superinstructions, which Run runs in place of the instructions
+	fused []interface{}
+
+	// startErr is returned by Step when the program cannot be run, because it
+	// fails verification or the type check or its entry point is not one of its lines
+	startErr error
+
+	// halted is set once the program executes a halt instruction
+	halted bool
+
+	// exitCode is the status the program halted with
+	exitCode int
+}
+
+// frame is an entry on the call stack
+type frame struct {
+	// returnIP is the instruction pointer to resume at on ret
+	returnIP int
+
+	// locals are the local variable slots of the call, unset slots are nil
+	locals []interface{}
+}
+
+// maxLocals is the number of local variable slots available to each call frame
+const maxLocals = 256
+
+// maxGlobals is the number of global variable slots available to a program
+const maxGlobals = 4096
+
+// function is a callable value referring to the line number of its entry point
+type function int
+
+func (f function) String() string {
+	return fmt.Sprintf("fn@%d", int(f))
 }
 
+// nilValue is the type of nil, the value used for absent or optional results.
+// It is distinct from a Go nil, which marks a variable slot that was never set.
+type nilValue struct{}
+
+func (nilValue) String() string {
+	return "nil"
+}
+
+// DefaultMaxCallDepth is the call depth limit used unless overridden with WithMaxCallDepth
+const DefaultMaxCallDepth = 1024
+
 type InterpreterOption func(*Interpreter)
 
 func NewInterpreter(program *Program, opts ...InterpreterOption) *Interpreter {
 	interpreter := &Interpreter{
-		program: program,
-		ip:      0,
-		stack:   make([]interface{}, 0, 64),
-		stdout:  os.Stdout,
-		debug:   false,
+		program:          program,
+		coroutine:        newCoroutine(0, 0),
+		variables:        make(map[string]interface{}),
+		maxCallDepth:     DefaultMaxCallDepth,
+		rand:             rand.New(rand.NewSource(time.Now().UnixNano())),
+		ctx:              context.Background(),
+		clock:            systemClock{},
+		env:              processEnv(),
+		hostFuncs:        make(map[string]HostFunc),
+		instructionFuncs: make(map[OpCode]instructionFunc),
+		verify:           true,
+		stdin:            bufio.NewReader(os.Stdin),
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+		debug:            false,
 	}
 	for _, opt := range opts {
 		opt(interpreter)
 	}
+	if interpreter.verify {
+		interpreter.startErr = Verify(program)
+	}
+	if interpreter.typeCheck && interpreter.startErr == nil {
+		interpreter.startErr = checkTypes(program)
+	}
+	interpreter.code = program.instructions
+	interpreter.fused = program.instructions
+	if interpreter.startErr == nil {
+		interpreter.fused = fuse(program)
+		interpreter.enter()
+	}
+	interpreter.started = interpreter.clock.Now()
 	return interpreter
 }
 
@@ -47,16 +201,95 @@ func EnableDebug(debug bool) InterpreterOption {
 	}
 }
 
+// WithStdin sets the reader that input instructions read from
+func WithStdin(r io.Reader) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.stdin = bufio.NewReader(r)
+	}
+}
+
 func WithStdout(w io.Writer) InterpreterOption {
 	return func(interpreter *Interpreter) {
 		interpreter.stdout = w
 	}
 }
 
+// WithStderr sets the writer that error output instructions print to
+func WithStderr(w io.Writer) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.stderr = w
+	}
+}
+
+// WithMaxCallDepth limits the number of nested calls a program may make
+func WithMaxCallDepth(depth int) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.maxCallDepth = depth
+	}
+}
+
+// WithCheckedArithmetic makes integer instructions fail with an error
+// when their result overflows instead of wrapping around
+func WithCheckedArithmetic(checked bool) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.checkedArithmetic = checked
+	}
+}
+
+// WithRandSource sets the source of random numbers for rand instructions
+func WithRandSource(src rand.Source) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.rand = rand.New(src)
+	}
+}
+
+// WithContext sets a context that stops the program when it is done
+func WithContext(ctx context.Context) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.ctx = ctx
+	}
+}
+
+// WithClock sets the source of time for time instructions
+func WithClock(clock Clock) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.clock = clock
+	}
+}
+
+// WithEnv sets the environment visible to getenv instructions in place of the process environment
+func WithEnv(env map[string]string) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.env = env
+	}
+}
+
+// WithFilesystem grants programs access to fs for the file operations in perm.
+// File access is disabled unless this option is given.
+func WithFilesystem(fs Filesystem, perm FilePermission) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.fs = fs
+		interpreter.filePerm = perm
+	}
+}
+
+// ExitCode returns the status the program halted with.
+// Programs that run off the end of their instructions exit with 0.
+func (i *Interpreter) ExitCode() int {
+	return i.exitCode
+}
+
 // Run runs the interpreter until completion.
 // If an error occurs during execution, that error is returned.
+// Common sequences of instructions are run as one, so Run
+// is faster than calling Step until the program ends.
 func (i *Interpreter) Run() error {
+	i.code = i.fused
+	defer func() { i.code = i.program.instructions }()
 	for {
+		if err := i.ctx.Err(); err != nil {
+			return errors.Wrap(err, "program interrupted")
+		}
 		if err := i.Step(); err != nil {
 			if err == io.EOF {
 				return nil
@@ -70,13 +303,26 @@ func (i *Interpreter) Run() error {
 // If there are no more instructions, EOF is returned.
 // If an error occurs during execution, that error is returned.
 func (i *Interpreter) Step() error {
+	if i.startErr != nil {
+		return i.startErr
+	}
+	opIP := i.ip
 	instruction, err := i.nextInstruction()
 	if err != nil {
+		if err == io.EOF && !i.halted {
+			return i.finishCoroutine()
+		}
 		return err
 	}
 	switch op := instruction.(type) {
 	case OpCode:
 		err := i.executeOp(op)
+		if err != nil && err != io.EOF && err != ErrBreakpoint {
+			err = i.catch(err)
+			if err != nil {
+				err = errors.Wrapf(err, "%v", i.program.locate(opIP))
+			}
+		}
 		i.dlog("stack: %#v", i.stack)
 		return err
 	default:
@@ -104,6 +350,14 @@ func (i *Interpreter) peek() (interface{}, error) {
 	return i.stack[len(i.stack)-1], nil
 }
 
+// requireDepth returns an error if the stack holds fewer than n values
+func (i *Interpreter) requireDepth(n int) error {
+	if len(i.stack) < n {
+		return errors.Errorf("stack underflow: need %d values, have %d", n, len(i.stack))
+	}
+	return nil
+}
+
 func (i *Interpreter) popInt() (int, error) {
 	v, err := i.pop()
 	if err != nil {
@@ -112,6 +366,63 @@ func (i *Interpreter) popInt() (int, error) {
 	return asInt(v)
 }
 
+// popIntPair consumes the top two values of the stack,
+// returning them in the order they were pushed
+func (i *Interpreter) popIntPair() (b, a int, err error) {
+	a, err = i.popInt()
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err = i.popInt()
+	if err != nil {
+		return 0, 0, err
+	}
+	return b, a, nil
+}
+
+// popIntOrBool consumes the top of the stack as an int,
+// treating booleans as 1 or 0 so they can drive jumps
+func (i *Interpreter) popIntOrBool() (int, error) {
+	v, err := i.pop()
+	if err != nil {
+		return 0, err
+	}
+	if b, ok := v.(bool); ok {
+		return boolToInt(b), nil
+	}
+	return asInt(v)
+}
+
+func (i *Interpreter) popBool() (bool, error) {
+	v, err := i.pop()
+	if err != nil {
+		return false, err
+	}
+	return asBool(v)
+}
+
+// popBigIntPair consumes the top two ints or bigints of the stack as bigints,
+// returning them in the order they were pushed
+func (i *Interpreter) popBigIntPair() (b, a *big.Int, err error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err = asBigInt(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err = i.pop()
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err = asBigInt(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, a, nil
+}
+
 func (i *Interpreter) popString() (string, error) {
 	v, err := i.pop()
 	if err != nil {
@@ -120,6 +431,102 @@ func (i *Interpreter) popString() (string, error) {
 	return asString(v)
 }
 
+func (i *Interpreter) popReference() (reference, error) {
+	v, err := i.pop()
+	if err != nil {
+		return 0, err
+	}
+	return asReference(v)
+}
+
+func (i *Interpreter) popArray() (*array, error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	return asArray(v)
+}
+
+func (i *Interpreter) peekArray() (*array, error) {
+	v, err := i.peek()
+	if err != nil {
+		return nil, err
+	}
+	return asArray(v)
+}
+
+func (i *Interpreter) popDict() (*dict, error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	return asDict(v)
+}
+
+func (i *Interpreter) peekDict() (*dict, error) {
+	v, err := i.peek()
+	if err != nil {
+		return nil, err
+	}
+	return asDict(v)
+}
+
+func (i *Interpreter) popRecord() (*record, error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	return asRecord(v)
+}
+
+func (i *Interpreter) peekRecord() (*record, error) {
+	v, err := i.peek()
+	if err != nil {
+		return nil, err
+	}
+	return asRecord(v)
+}
+
+func (i *Interpreter) popBuffer() (*buffer, error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	return asBuffer(v)
+}
+
+func (i *Interpreter) peekBuffer() (*buffer, error) {
+	v, err := i.peek()
+	if err != nil {
+		return nil, err
+	}
+	return asBuffer(v)
+}
+
+func (i *Interpreter) popDictKey() (interface{}, error) {
+	v, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	return asDictKey(v)
+}
+
+func (i *Interpreter) popFunction() (function, error) {
+	v, err := i.pop()
+	if err != nil {
+		return 0, err
+	}
+	return asFunction(v)
+}
+
+func (i *Interpreter) popFloat() (float64, error) {
+	v, err := i.pop()
+	if err != nil {
+		return 0, err
+	}
+	return asFloat(v)
+}
+
 func (i *Interpreter) executeOp(op OpCode) error {
 	switch op {
 	case OpPutln:
@@ -159,7 +566,7 @@ func (i *Interpreter) executeOp(op OpCode) error {
 		if err != nil {
 			return err
 		}
-		top, err := i.popInt()
+		top, err := i.popIntOrBool()
 		if err != nil {
 			return err
 		}
@@ -168,6 +575,51 @@ func (i *Interpreter) executeOp(op OpCode) error {
 		}
 		i.dlog("jump %d<%d ? %d => %d jumped=%v", top, value, line, i.ip, top < value)
 		return nil
+	case OpDedupStack:
+		before := len(i.stack)
+		i.dedupStack()
+		i.dlog("dedup %d => %d", before, len(i.stack))
+		return nil
+	case OpShowInstr:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		text, err := i.program.lineText(line)
+		if err != nil {
+			return err
+		}
+		i.push(text)
+		i.dlog("showinstr %d => %s", line, text)
+		return nil
+	case OpHalt:
+		code, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		i.halted = true
+		i.exitCode = code
+		i.dlog("halt %d", code)
+		return io.EOF
+	case OpNop:
+		i.dlog("nop")
+		return nil
+	case OpLoadc:
+		index, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(i.program.constants) {
+			return errors.Errorf("invalid constant index %d", index)
+		}
+		value := i.program.constants[index]
+		if bigValue, ok := value.(*big.Int); ok {
+			// copy so the program's constant is never mutated
+			value = new(big.Int).Set(bigValue)
+		}
+		i.push(value)
+		i.dlog("loadc %d => %v", index, value)
+		return nil
 	case OpIpush:
 		value, err := i.nextInt()
 		if err != nil {
@@ -185,10 +637,29 @@ func (i *Interpreter) executeOp(op OpCode) error {
 		if err != nil {
 			return err
 		}
+		if err := i.checkOverflow(addOverflows(b, a), InstructionIadd, b, a); err != nil {
+			return err
+		}
 		c := b + a
 		i.push(c)
 		i.dlog("iadd %d + %d = %d", b, a, c)
 		return nil
+	case OpImultiply:
+		a, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		b, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if err := i.checkOverflow(mulOverflows(b, a), InstructionImultiply, b, a); err != nil {
+			return err
+		}
+		c := b * a
+		i.push(c)
+		i.dlog("imul %d * %d = %d", b, a, c)
+		return nil
 	case OpIsubtract:
 		a, err := i.popInt()
 		if err != nil {
@@ -198,56 +669,1765 @@ func (i *Interpreter) executeOp(op OpCode) error {
 		if err != nil {
 			return err
 		}
+		if err := i.checkOverflow(subOverflows(b, a), InstructionIsubtract, b, a); err != nil {
+			return err
+		}
 		c := b - a
 		i.push(c)
 		i.dlog("isub %d - %d = %d", b, a, c)
 		return nil
-	case OpSpush:
-		value, err := i.nextString()
+	case OpIdivide:
+		a, err := i.popInt()
 		if err != nil {
 			return err
 		}
-		i.push(value)
-		i.dlog("spush %s", value)
+		b, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if a == 0 {
+			return errors.New("division by zero")
+		}
+		if err := i.checkOverflow(divOverflows(b, a), InstructionIdivide, b, a); err != nil {
+			return err
+		}
+		c := b / a
+		i.push(c)
+		i.dlog("idiv %d / %d = %d", b, a, c)
 		return nil
-	case OpSadd:
-		a, err := i.popString()
+	case OpImodulo:
+		a, err := i.popInt()
 		if err != nil {
 			return err
 		}
-		b, err := i.popString()
+		b, err := i.popInt()
 		if err != nil {
 			return err
 		}
-		c := b + a
+		if a == 0 {
+			return errors.New("modulo by zero")
+		}
+		c := b % a
 		i.push(c)
-		i.dlog("sadd %s + %s = %s", b, a, c)
+		i.dlog("imod %d %% %d = %d", b, a, c)
 		return nil
-	}
-	return errors.Errorf("invalid op code: %v", op)
-}
-
-func (i *Interpreter) jump(line int) error {
-	index := line - 1 // convert 1-based line number to 0-base jumpTable index
-	if index < 0 || index >= len(i.program.jumpTable) {
-		return errors.New("invalid jump index")
-	}
-	i.ip = i.program.jumpTable[index]
-	return nil
-}
-
-func (i *Interpreter) nextInstruction() (interface{}, error) {
-	if i.ip == len(i.program.instructions) {
-		return nil, io.EOF
-	}
-	instruction := i.program.instructions[i.ip]
-	i.ip++
-	return instruction, nil
-}
-
-func (i *Interpreter) nextInt() (int, error) {
-	instruction, err := i.nextInstruction()
-	if err != nil {
+	case OpInegate:
+		a, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if err := i.checkOverflow(negOverflows(a), InstructionInegate, a); err != nil {
+			return err
+		}
+		c := -a
+		i.push(c)
+		i.dlog("ineg %d = %d", a, c)
+		return nil
+	case OpIabsolute:
+		a, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if err := i.checkOverflow(negOverflows(a), InstructionIabsolute, a); err != nil {
+			return err
+		}
+		c := a
+		if c < 0 {
+			c = -c
+		}
+		i.push(c)
+		i.dlog("iabs %d = %d", a, c)
+		return nil
+	case OpIincrement:
+		k, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		top, err := i.peek()
+		if err != nil {
+			return err
+		}
+		a, err := asInt(top)
+		if err != nil {
+			return err
+		}
+		if err := i.checkOverflow(addOverflows(a, k), InstructionIincrement, a, k); err != nil {
+			return err
+		}
+		c := a + k
+		i.stack[len(i.stack)-1] = c
+		i.dlog("iinc %d + %d = %d", a, k, c)
+		return nil
+	case OpSpush:
+		value, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("spush %s", value)
+		return nil
+	case OpSadd:
+		a, err := i.popString()
+		if err != nil {
+			return err
+		}
+		b, err := i.popString()
+		if err != nil {
+			return err
+		}
+		c := b + a
+		i.push(c)
+		i.dlog("sadd %s + %s = %s", b, a, c)
+		return nil
+	case OpSsub:
+		end, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		start, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		runes := []rune(str)
+		if start < 0 || end > len(runes) || start > end {
+			return errors.Errorf("substring [%d, %d) out of range for string of length %d", start, end, len(runes))
+		}
+		sub := string(runes[start:end])
+		i.push(sub)
+		i.dlog("ssub %s[%d:%d] = %s", str, start, end, sub)
+		return nil
+	case OpSchar:
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		runes := []rune(str)
+		if index < 0 || index >= len(runes) {
+			return errors.Errorf("string index %d out of range [0, %d)", index, len(runes))
+		}
+		char := string(runes[index])
+		i.push(char)
+		i.dlog("schar %s[%d] = %s", str, index, char)
+		return nil
+	case OpSlen:
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		length := utf8.RuneCountInString(str)
+		i.push(length)
+		i.dlog("slen %s = %d", str, length)
+		return nil
+	case OpSblen:
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		length := len(str)
+		i.push(length)
+		i.dlog("sblen %s = %d", str, length)
+		return nil
+	case OpSeq:
+		a, err := i.popString()
+		if err != nil {
+			return err
+		}
+		b, err := i.popString()
+		if err != nil {
+			return err
+		}
+		c := b == a
+		i.push(c)
+		i.dlog("seq %s == %s = %v", b, a, c)
+		return nil
+	case OpScmp:
+		a, err := i.popString()
+		if err != nil {
+			return err
+		}
+		b, err := i.popString()
+		if err != nil {
+			return err
+		}
+		c := strings.Compare(b, a)
+		i.push(c)
+		i.dlog("scmp %s <=> %s = %d", b, a, c)
+		return nil
+	case OpFpush:
+		value, err := i.nextFloat()
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("fpush %g", value)
+		return nil
+	case OpFadd:
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		b, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		c := b + a
+		i.push(c)
+		i.dlog("fadd %g + %g = %g", b, a, c)
+		return nil
+	case OpFsubtract:
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		b, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		c := b - a
+		i.push(c)
+		i.dlog("fsub %g - %g = %g", b, a, c)
+		return nil
+	case OpFmultiply:
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		b, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		c := b * a
+		i.push(c)
+		i.dlog("fmul %g * %g = %g", b, a, c)
+		return nil
+	case OpFdivide:
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		b, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		if a == 0 {
+			return errors.New("division by zero")
+		}
+		c := b / a
+		i.push(c)
+		i.dlog("fdiv %g / %g = %g", b, a, c)
+		return nil
+	case OpBand:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b & a
+		i.push(c)
+		i.dlog("band %d & %d = %d", b, a, c)
+		return nil
+	case OpBor:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b | a
+		i.push(c)
+		i.dlog("bor %d | %d = %d", b, a, c)
+		return nil
+	case OpBxor:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b ^ a
+		i.push(c)
+		i.dlog("bxor %d ^ %d = %d", b, a, c)
+		return nil
+	case OpBnot:
+		a, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		c := ^a
+		i.push(c)
+		i.dlog("bnot ^%d = %d", a, c)
+		return nil
+	case OpShiftLeft:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		if a < 0 {
+			return errors.Errorf("negative shift amount: %d", a)
+		}
+		c := b << uint(a)
+		i.push(c)
+		i.dlog("shl %d << %d = %d", b, a, c)
+		return nil
+	case OpShiftRight:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		if a < 0 {
+			return errors.Errorf("negative shift amount: %d", a)
+		}
+		c := b >> uint(a)
+		i.push(c)
+		i.dlog("shr %d >> %d = %d", b, a, c)
+		return nil
+	case OpIequal:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b == a
+		i.push(c)
+		i.dlog("ieq %d == %d = %v", b, a, c)
+		return nil
+	case OpInotEqual:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b != a
+		i.push(c)
+		i.dlog("ine %d != %d = %v", b, a, c)
+		return nil
+	case OpIlessThan:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b < a
+		i.push(c)
+		i.dlog("ilt %d < %d = %v", b, a, c)
+		return nil
+	case OpIlessEqual:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b <= a
+		i.push(c)
+		i.dlog("ile %d <= %d = %v", b, a, c)
+		return nil
+	case OpIgreaterThan:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b > a
+		i.push(c)
+		i.dlog("igt %d > %d = %v", b, a, c)
+		return nil
+	case OpIgreaterEqual:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b >= a
+		i.push(c)
+		i.dlog("ige %d >= %d = %v", b, a, c)
+		return nil
+	case OpBpush:
+		value, err := i.nextBool()
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("bpush %v", value)
+		return nil
+	case OpAnd:
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		b, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		c := b && a
+		i.push(c)
+		i.dlog("and %v && %v = %v", b, a, c)
+		return nil
+	case OpOr:
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		b, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		c := b || a
+		i.push(c)
+		i.dlog("or %v || %v = %v", b, a, c)
+		return nil
+	case OpNot:
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		c := !a
+		i.push(c)
+		i.dlog("not !%v = %v", a, c)
+		return nil
+	case OpJumpEqual:
+		return i.jumpIf(InstructionJumpEqual, func(top, value int) bool { return top == value })
+	case OpJumpNotEqual:
+		return i.jumpIf(InstructionJumpNotEqual, func(top, value int) bool { return top != value })
+	case OpJumpGreaterThan:
+		return i.jumpIf(InstructionJumpGreaterThan, func(top, value int) bool { return top > value })
+	case OpJumpGreaterEqual:
+		return i.jumpIf(InstructionJumpGreaterEqual, func(top, value int) bool { return top >= value })
+	case OpJumpLessEqual:
+		return i.jumpIf(InstructionJumpLessEqual, func(top, value int) bool { return top <= value })
+	case OpJumpZero:
+		return i.jumpWhen(InstructionJumpZero, func(top int) bool { return top == 0 })
+	case OpJumpNotZero:
+		return i.jumpWhen(InstructionJumpNotZero, func(top int) bool { return top != 0 })
+	case OpJumpDynamic:
+		line, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		err = i.jump(line)
+		i.dlog("jumpd %d => %d", line, i.ip)
+		return err
+	case OpJumpTable:
+		lines, err := i.nextIntList()
+		if err != nil {
+			return err
+		}
+		defaultLine, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		line := defaultLine
+		if index >= 0 && index < len(lines) {
+			line = lines[index]
+		}
+		err = i.jump(line)
+		i.dlog("jtable %d %v ? %d => %d", index, lines, defaultLine, i.ip)
+		return err
+	case OpSwap:
+		if err := i.requireDepth(2); err != nil {
+			return err
+		}
+		n := len(i.stack)
+		i.stack[n-1], i.stack[n-2] = i.stack[n-2], i.stack[n-1]
+		i.dlog("swap %v <=> %v", i.stack[n-1], i.stack[n-2])
+		return nil
+	case OpOver:
+		if err := i.requireDepth(2); err != nil {
+			return err
+		}
+		value := i.stack[len(i.stack)-2]
+		i.push(value)
+		i.dlog("over %v", value)
+		return nil
+	case OpRot:
+		if err := i.requireDepth(3); err != nil {
+			return err
+		}
+		n := len(i.stack)
+		a, b, c := i.stack[n-3], i.stack[n-2], i.stack[n-1]
+		i.stack[n-3], i.stack[n-2], i.stack[n-1] = b, c, a
+		i.dlog("rot %v %v %v => %v %v %v", a, b, c, b, c, a)
+		return nil
+	case OpDrop:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.dlog("drop %v", value)
+		return nil
+	case OpPick:
+		n, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return errors.Errorf("invalid pick index %d", n)
+		}
+		if err := i.requireDepth(n + 1); err != nil {
+			return err
+		}
+		value := i.stack[len(i.stack)-1-n]
+		i.push(value)
+		i.dlog("pick %d => %v", n, value)
+		return nil
+	case OpDepth:
+		depth := len(i.stack)
+		i.push(depth)
+		i.dlog("depth %d", depth)
+		return nil
+	case OpClear:
+		dropped := len(i.stack)
+		i.stack = i.stack[:0]
+		i.dlog("clear dropped %d", dropped)
+		return nil
+	case OpDupn:
+		n, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return errors.Errorf("invalid dupn count %d", n)
+		}
+		if err := i.requireDepth(n); err != nil {
+			return err
+		}
+		i.stack = append(i.stack, i.stack[len(i.stack)-n:]...)
+		i.dlog("dupn %d", n)
+		return nil
+	case OpCall:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if err := i.call(line); err != nil {
+			return err
+		}
+		i.dlog("call %d => %d depth=%d", line, i.ip, len(i.frames))
+		return nil
+	case OpTailCall:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if len(i.frames) == 0 {
+			// there is no frame to reuse at the top level
+			if err := i.call(line); err != nil {
+				return err
+			}
+		} else {
+			if err := i.jump(line); err != nil {
+				return err
+			}
+			i.frames[len(i.frames)-1].locals = nil
+			// the handlers of the replaced call can no longer catch
+			i.dropHandlers(len(i.frames) - 1)
+		}
+		i.dlog("tcall %d => %d depth=%d", line, i.ip, len(i.frames))
+		return nil
+	case OpCpush:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if _, err := i.lineIP(line); err != nil {
+			return err
+		}
+		fn := function(line)
+		i.push(fn)
+		i.dlog("cpush %v", fn)
+		return nil
+	case OpCalli:
+		fn, err := i.popFunction()
+		if err != nil {
+			return err
+		}
+		if err := i.call(int(fn)); err != nil {
+			return err
+		}
+		i.dlog("calli %v => %d depth=%d", fn, i.ip, len(i.frames))
+		return nil
+	case OpReturn:
+		if len(i.frames) == 0 {
+			return errors.New("ret with empty call stack")
+		}
+		var f frame
+		f, i.frames = i.frames[len(i.frames)-1], i.frames[:len(i.frames)-1]
+		i.dropHandlers(len(i.frames))
+		if f.returnIP == coroutineExitIP {
+			return i.finishCoroutine()
+		}
+		i.ip = f.returnIP
+		i.dlog("ret => %d depth=%d", i.ip, len(i.frames))
+		return nil
+	case OpSpawn:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		co, err := i.spawn(line)
+		if err != nil {
+			return err
+		}
+		i.dlog("spawn %d => coroutine %d", line, co.id)
+		return nil
+	case OpYield:
+		from := i.id
+		i.yield()
+		i.dlog("yield coroutine %d => %d", from, i.id)
+		return nil
+	case OpLoadl:
+		slot, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		f, err := i.localFrame(slot)
+		if err != nil {
+			return err
+		}
+		if slot >= len(f.locals) || f.locals[slot] == nil {
+			return errors.Errorf("local variable %d is not set", slot)
+		}
+		value := f.locals[slot]
+		i.push(value)
+		i.dlog("loadl %d => %v", slot, value)
+		return nil
+	case OpStorel:
+		slot, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		f, err := i.localFrame(slot)
+		if err != nil {
+			return err
+		}
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		if slot >= len(f.locals) {
+			locals := make([]interface{}, slot+1)
+			copy(locals, f.locals)
+			f.locals = locals
+		}
+		f.locals[slot] = value
+		i.dlog("storel %d <= %v", slot, value)
+		return nil
+	case OpGload:
+		slot, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if slot < 0 || slot >= maxGlobals {
+			return errors.Errorf("invalid global variable slot %d", slot)
+		}
+		if slot >= len(i.globals) || i.globals[slot] == nil {
+			return errors.Errorf("global variable %d is not set", slot)
+		}
+		value := i.globals[slot]
+		i.push(value)
+		i.dlog("gload %d => %v", slot, value)
+		return nil
+	case OpGstore:
+		slot, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if slot < 0 || slot >= maxGlobals {
+			return errors.Errorf("invalid global variable slot %d", slot)
+		}
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		if slot >= len(i.globals) {
+			globals := make([]interface{}, slot+1)
+			copy(globals, i.globals)
+			i.globals = globals
+		}
+		i.globals[slot] = value
+		i.dlog("gstore %d <= %v", slot, value)
+		return nil
+	case OpLoad:
+		name, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		value, ok := i.variables[name]
+		if !ok {
+			return errors.Errorf("undefined variable %s", name)
+		}
+		i.push(value)
+		i.dlog("load %s => %v", name, value)
+		return nil
+	case OpStore:
+		name, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.variables[name] = value
+		i.dlog("store %s <= %v", name, value)
+		return nil
+	case OpAlloc:
+		ref := i.heap.alloc()
+		i.push(ref)
+		i.dlog("alloc %v", ref)
+		return nil
+	case OpFree:
+		ref, err := i.popReference()
+		if err != nil {
+			return err
+		}
+		if err := i.heap.release(ref); err != nil {
+			return err
+		}
+		i.dlog("free %v", ref)
+		return nil
+	case OpRload:
+		ref, err := i.popReference()
+		if err != nil {
+			return err
+		}
+		value, err := i.heap.load(ref)
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("rload %v => %v", ref, value)
+		return nil
+	case OpRstore:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		ref, err := i.popReference()
+		if err != nil {
+			return err
+		}
+		if err := i.heap.store(ref, value); err != nil {
+			return err
+		}
+		i.dlog("rstore %v <= %v", ref, value)
+		return nil
+	case OpMload:
+		addr, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if err := i.checkAddress(addr); err != nil {
+			return err
+		}
+		value := i.memory[addr]
+		i.push(value)
+		i.dlog("mload %d => %d", addr, value)
+		return nil
+	case OpMstore:
+		addr, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if err := i.checkAddress(addr); err != nil {
+			return err
+		}
+		value, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		i.memory[addr] = value
+		i.dlog("mstore %d <= %d", addr, value)
+		return nil
+	case OpAnew:
+		arr := &array{}
+		i.push(arr)
+		i.dlog("anew")
+		return nil
+	case OpAget:
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		arr, err := i.popArray()
+		if err != nil {
+			return err
+		}
+		value, err := arr.get(index)
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("aget %v[%d] => %v", arr, index, value)
+		return nil
+	case OpAset:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		arr, err := i.peekArray()
+		if err != nil {
+			return err
+		}
+		if err := arr.set(index, value); err != nil {
+			return err
+		}
+		i.dlog("aset [%d] <= %v => %v", index, value, arr)
+		return nil
+	case OpAlen:
+		arr, err := i.popArray()
+		if err != nil {
+			return err
+		}
+		length := len(arr.values)
+		i.push(length)
+		i.dlog("alen %v = %d", arr, length)
+		return nil
+	case OpApush:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		arr, err := i.peekArray()
+		if err != nil {
+			return err
+		}
+		arr.values = append(arr.values, value)
+		i.dlog("apush %v => %v", value, arr)
+		return nil
+	case OpMnew:
+		d := newDict()
+		i.push(d)
+		i.dlog("mnew")
+		return nil
+	case OpMget:
+		key, err := i.popDictKey()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		value, err := d.get(key)
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("mget %v[%v] => %v", d, key, value)
+		return nil
+	case OpMset:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		key, err := i.popDictKey()
+		if err != nil {
+			return err
+		}
+		d, err := i.peekDict()
+		if err != nil {
+			return err
+		}
+		d.values[key] = value
+		i.dlog("mset [%v] <= %v => %v", key, value, d)
+		return nil
+	case OpMhas:
+		key, err := i.popDictKey()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		_, has := d.values[key]
+		i.push(has)
+		i.dlog("mhas %v[%v] = %v", d, key, has)
+		return nil
+	case OpMdel:
+		key, err := i.popDictKey()
+		if err != nil {
+			return err
+		}
+		d, err := i.peekDict()
+		if err != nil {
+			return err
+		}
+		delete(d.values, key)
+		i.dlog("mdel [%v] => %v", key, d)
+		return nil
+	case OpMlen:
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		length := len(d.values)
+		i.push(length)
+		i.dlog("mlen %v = %d", d, length)
+		return nil
+	case OpSupper:
+		return i.transformString(InstructionSupper, strings.ToUpper)
+	case OpSlower:
+		return i.transformString(InstructionSlower, strings.ToLower)
+	case OpStrim:
+		return i.transformString(InstructionStrim, strings.TrimSpace)
+	case OpSsplit:
+		sep, err := i.popString()
+		if err != nil {
+			return err
+		}
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(str, sep)
+		arr := &array{values: make([]interface{}, len(parts))}
+		for index, part := range parts {
+			arr.values[index] = part
+		}
+		i.push(arr)
+		i.dlog("ssplit %q by %q = %v", str, sep, arr)
+		return nil
+	case OpSjoin:
+		sep, err := i.popString()
+		if err != nil {
+			return err
+		}
+		arr, err := i.popArray()
+		if err != nil {
+			return err
+		}
+		parts := make([]string, len(arr.values))
+		for index, value := range arr.values {
+			part, err := asString(value)
+			if err != nil {
+				return errors.Wrapf(err, "unable to join array index %d", index)
+			}
+			parts[index] = part
+		}
+		str := strings.Join(parts, sep)
+		i.push(str)
+		i.dlog("sjoin %v by %q = %q", arr, sep, str)
+		return nil
+	case OpSfind:
+		substr, err := i.popString()
+		if err != nil {
+			return err
+		}
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		index := strings.Index(str, substr)
+		if index > 0 {
+			index = utf8.RuneCountInString(str[:index])
+		}
+		i.push(index)
+		i.dlog("sfind %q in %q = %d", substr, str, index)
+		return nil
+	case OpSreplace:
+		replacement, err := i.popString()
+		if err != nil {
+			return err
+		}
+		substr, err := i.popString()
+		if err != nil {
+			return err
+		}
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		result := strings.Replace(str, substr, replacement, -1)
+		i.push(result)
+		i.dlog("sreplace %q with %q in %q = %q", substr, replacement, str, result)
+		return nil
+	case OpSfmt:
+		format, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		args, err := i.popFormatArgs(format)
+		if err != nil {
+			return err
+		}
+		str := fmt.Sprintf(format, args...)
+		i.push(str)
+		i.dlog("sfmt %q %v = %q", format, args, str)
+		return nil
+	case OpSbytes:
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		buf := &buffer{bytes: []byte(str)}
+		i.push(buf)
+		i.dlog("sbytes %q => %v", str, buf)
+		return nil
+	case OpPutf:
+		format, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		args, err := i.popFormatArgs(format)
+		if err != nil {
+			return err
+		}
+		i.toStdoutf(format, args...)
+		i.dlog("putf %q %v", format, args)
+		return nil
+	case OpReadi:
+		word, err := i.readWord()
+		if err != nil {
+			return err
+		}
+		value, err := strconv.Atoi(word)
+		if err != nil {
+			return errors.Errorf("unable to read %q as int", word)
+		}
+		i.push(value)
+		i.dlog("readi %d", value)
+		return nil
+	case OpReads:
+		word, err := i.readWord()
+		if err != nil {
+			return err
+		}
+		i.push(word)
+		i.dlog("reads %q", word)
+		return nil
+	case OpReadline:
+		line, err := i.readLine()
+		if err != nil {
+			return err
+		}
+		i.push(line)
+		i.dlog("readline %q", line)
+		return nil
+	case OpEput:
+		top, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.toStderr(top)
+		i.dlog("eput %v", top)
+		return nil
+	case OpEputln:
+		i.toStderr("\n")
+		i.dlog("eputln")
+		return nil
+	case OpItos:
+		value, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		str := strconv.Itoa(value)
+		i.push(str)
+		i.dlog("itos %d = %q", value, str)
+		return nil
+	case OpStoi:
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		value, err := strconv.Atoi(str)
+		if err != nil {
+			return errors.Errorf("unable to convert %q to int", str)
+		}
+		i.push(value)
+		i.dlog("stoi %q = %d", str, value)
+		return nil
+	case OpChr:
+		value, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if !utf8.ValidRune(rune(value)) || int(rune(value)) != value {
+			return errors.Errorf("invalid code point %d", value)
+		}
+		str := string(rune(value))
+		i.push(str)
+		i.dlog("chr %d = %q", value, str)
+		return nil
+	case OpOrd:
+		str, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if str == "" {
+			return errors.New("ord of empty string")
+		}
+		value, _ := utf8.DecodeRuneInString(str)
+		i.push(int(value))
+		i.dlog("ord %q = %d", str, value)
+		return nil
+	case OpTypeof:
+		value, err := i.peek()
+		if err != nil {
+			return err
+		}
+		name := typeName(value)
+		i.push(name)
+		i.dlog("typeof %v = %s", value, name)
+		return nil
+	case OpAssert:
+		message, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		condition, err := i.popIntOrBool()
+		if err != nil {
+			return err
+		}
+		if condition == 0 {
+			return errors.Errorf("assertion failed: %s", message)
+		}
+		i.dlog("assert %q passed", message)
+		return nil
+	case OpBrk:
+		i.dlog("brk")
+		return i.breakpoint()
+	case OpBtrace:
+		trace := i.backtrace(i.ip - 1)
+		arr := &array{values: make([]interface{}, len(trace))}
+		for index, f := range trace {
+			arr.values[index] = f.String()
+		}
+		i.push(arr)
+		i.dlog("btrace %v", arr)
+		return nil
+	case OpTry:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		catchIP, err := i.lineIP(line)
+		if err != nil {
+			return err
+		}
+		i.handlers = append(i.handlers, handler{
+			catchIP: catchIP,
+			depth:   len(i.stack),
+			frames:  len(i.frames),
+		})
+		i.dlog("try %d handlers=%d", line, len(i.handlers))
+		return nil
+	case OpThrow:
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.dlog("throw %v", value)
+		return &thrownError{value: value}
+	case OpEndTry:
+		if len(i.handlers) == 0 {
+			return errors.New("endtry without try")
+		}
+		i.handlers = i.handlers[:len(i.handlers)-1]
+		i.dlog("endtry handlers=%d", len(i.handlers))
+		return nil
+	case OpRand:
+		n, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return errors.Errorf("invalid rand bound %d", n)
+		}
+		value := i.rand.Intn(n)
+		i.push(value)
+		i.dlog("rand %d = %d", n, value)
+		return nil
+	case OpNow:
+		value := int(i.clock.Now().UnixNano() / int64(time.Millisecond))
+		i.push(value)
+		i.dlog("now %d", value)
+		return nil
+	case OpElapsed:
+		value := millis(i.clock.Now().Sub(i.started))
+		i.push(value)
+		i.dlog("elapsed %d", value)
+		return nil
+	case OpSleep:
+		ms, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if ms < 0 {
+			return errors.Errorf("invalid sleep duration %d", ms)
+		}
+		i.dlog("sleep %d", ms)
+		return i.sleep(time.Duration(ms) * time.Millisecond)
+	case OpGetenv:
+		name, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		value := i.env[name]
+		i.push(value)
+		i.dlog("getenv %s = %q", name, value)
+		return nil
+	case OpFread:
+		path, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if err := i.checkFilePermission(FileRead); err != nil {
+			return err
+		}
+		data, err := i.fs.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read file %s", path)
+		}
+		i.push(string(data))
+		i.dlog("fread %s %d bytes", path, len(data))
+		return nil
+	case OpFwrite:
+		contents, err := i.popString()
+		if err != nil {
+			return err
+		}
+		path, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if err := i.checkFilePermission(FileWrite); err != nil {
+			return err
+		}
+		if err := i.fs.WriteFile(path, []byte(contents)); err != nil {
+			return errors.Wrapf(err, "unable to write file %s", path)
+		}
+		i.dlog("fwrite %s %d bytes", path, len(contents))
+		return nil
+	case OpHostcall:
+		name, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		argc, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		fn, ok := i.hostFuncs[name]
+		if !ok {
+			return errors.Errorf("unknown host function %s", name)
+		}
+		args, results, err := i.callHostFunc(fn, argc)
+		if err != nil {
+			return errors.Wrapf(err, "host function %s failed", name)
+		}
+		i.dlog("hostcall %s %v => %v", name, args, results)
+		return nil
+	case OpSys:
+		n, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= len(i.syscalls) || i.syscalls[n].Func == nil {
+			return errors.Errorf("invalid syscall %d", n)
+		}
+		syscall := i.syscalls[n]
+		args, results, err := i.callHostFunc(syscall.Func, syscall.Argc)
+		if err != nil {
+			return errors.Wrapf(err, "syscall %d failed", n)
+		}
+		i.dlog("sys %d %v => %v", n, args, results)
+		return nil
+	case OpChnew:
+		capacity, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		if capacity < 1 {
+			return errors.Errorf("invalid channel capacity %d", capacity)
+		}
+		ch := &channel{capacity: capacity}
+		i.push(ch)
+		i.dlog("chnew %v", ch)
+		return nil
+	case OpChsend:
+		if err := i.requireDepth(2); err != nil {
+			return err
+		}
+		ch, err := asChannel(i.stack[len(i.stack)-2])
+		if err != nil {
+			return err
+		}
+		if ch.full() {
+			i.dlog("chsend %v blocked coroutine %d", ch, i.id)
+			return i.block(i.ip - 1)
+		}
+		value, _ := i.pop()
+		i.pop()
+		ch.buffer = append(ch.buffer, value)
+		i.unblockAll()
+		i.dlog("chsend %v <= %v", ch, value)
+		return nil
+	case OpChrecv:
+		top, err := i.peek()
+		if err != nil {
+			return err
+		}
+		ch, err := asChannel(top)
+		if err != nil {
+			return err
+		}
+		if ch.empty() {
+			i.dlog("chrecv %v blocked coroutine %d", ch, i.id)
+			return i.block(i.ip - 1)
+		}
+		i.pop()
+		var value interface{}
+		value, ch.buffer = ch.buffer[0], ch.buffer[1:]
+		i.push(value)
+		i.unblockAll()
+		i.dlog("chrecv %v => %v", ch, value)
+		return nil
+	case OpMin:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b
+		if a < b {
+			c = a
+		}
+		i.push(c)
+		i.dlog("min %d %d = %d", b, a, c)
+		return nil
+	case OpMax:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		c := b
+		if a > b {
+			c = a
+		}
+		i.push(c)
+		i.dlog("max %d %d = %d", b, a, c)
+		return nil
+	case OpPow:
+		b, a, err := i.popIntPair()
+		if err != nil {
+			return err
+		}
+		if a < 0 {
+			return errors.Errorf("negative exponent: %d", a)
+		}
+		if i.checkedArithmetic {
+			if err := i.checkOverflow(powOverflows(b, a), InstructionPow, b, a); err != nil {
+				return err
+			}
+		}
+		c := ipow(b, a)
+		i.push(c)
+		i.dlog("pow %d ** %d = %d", b, a, c)
+		return nil
+	case OpSqrt:
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		if a < 0 {
+			return errors.Errorf("square root of negative number: %g", a)
+		}
+		c := math.Sqrt(a)
+		i.push(c)
+		i.dlog("sqrt %g = %g", a, c)
+		return nil
+	case OpBigpush:
+		instruction, err := i.nextInstruction()
+		if err != nil {
+			return err
+		}
+		value, err := asBigInt(instruction)
+		if err != nil {
+			return err
+		}
+		// copy so the program's constant is never mutated
+		value = new(big.Int).Set(value)
+		i.push(value)
+		i.dlog("bigpush %v", value)
+		return nil
+	case OpBigadd:
+		b, a, err := i.popBigIntPair()
+		if err != nil {
+			return err
+		}
+		c := new(big.Int).Add(b, a)
+		i.push(c)
+		i.dlog("bigadd %v + %v = %v", b, a, c)
+		return nil
+	case OpBigsubtract:
+		b, a, err := i.popBigIntPair()
+		if err != nil {
+			return err
+		}
+		c := new(big.Int).Sub(b, a)
+		i.push(c)
+		i.dlog("bigsub %v - %v = %v", b, a, c)
+		return nil
+	case OpBigmultiply:
+		b, a, err := i.popBigIntPair()
+		if err != nil {
+			return err
+		}
+		c := new(big.Int).Mul(b, a)
+		i.push(c)
+		i.dlog("bigmul %v * %v = %v", b, a, c)
+		return nil
+	case OpBigdivide:
+		b, a, err := i.popBigIntPair()
+		if err != nil {
+			return err
+		}
+		if a.Sign() == 0 {
+			return errors.New("division by zero")
+		}
+		c := new(big.Int).Quo(b, a)
+		i.push(c)
+		i.dlog("bigdiv %v / %v = %v", b, a, c)
+		return nil
+	case OpNpush:
+		i.push(nilValue{})
+		i.dlog("npush")
+		return nil
+	case OpJnil:
+		line, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		top, err := i.pop()
+		if err != nil {
+			return err
+		}
+		_, jumped := top.(nilValue)
+		if jumped {
+			if err := i.jump(line); err != nil {
+				return err
+			}
+		}
+		i.dlog("jnil %v ? %d => %d jumped=%v", top, line, i.ip, jumped)
+		return nil
+	case OpJrel:
+		offset, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		line := i.program.lineOf(i.ip-2) + offset
+		if err := i.jump(line); err != nil {
+			return err
+		}
+		i.dlog("jrel %+d => %d", offset, i.ip)
+		return nil
+	case OpJrell:
+		value, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		offset, err := i.nextInt()
+		if err != nil {
+			return err
+		}
+		line := i.program.lineOf(i.ip-3) + offset
+		top, err := i.popIntOrBool()
+		if err != nil {
+			return err
+		}
+		jumped := top < value
+		if jumped {
+			if err := i.jump(line); err != nil {
+				return err
+			}
+		}
+		i.dlog("jrell %d<%d ? %+d => %d jumped=%v", top, value, offset, i.ip, jumped)
+		return nil
+	case OpRnew:
+		r := newRecord()
+		i.push(r)
+		i.dlog("rnew")
+		return nil
+	case OpRget:
+		field, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		r, err := i.popRecord()
+		if err != nil {
+			return err
+		}
+		value, err := r.get(field)
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("rget %v.%s => %v", r, field, value)
+		return nil
+	case OpRset:
+		field, err := i.nextString()
+		if err != nil {
+			return err
+		}
+		value, err := i.pop()
+		if err != nil {
+			return err
+		}
+		r, err := i.peekRecord()
+		if err != nil {
+			return err
+		}
+		r.set(field, value)
+		i.dlog("rset .%s <= %v => %v", field, value, r)
+		return nil
+	case OpBnew:
+		length, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		if length < 0 {
+			return errors.Errorf("invalid buffer length %d", length)
+		}
+		buf := &buffer{bytes: make([]byte, length)}
+		i.push(buf)
+		i.dlog("bnew %d", length)
+		return nil
+	case OpBget:
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		buf, err := i.popBuffer()
+		if err != nil {
+			return err
+		}
+		value, err := buf.get(index)
+		if err != nil {
+			return err
+		}
+		i.push(value)
+		i.dlog("bget %v[%d] => %d", buf, index, value)
+		return nil
+	case OpBset:
+		value, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		index, err := i.popInt()
+		if err != nil {
+			return err
+		}
+		buf, err := i.peekBuffer()
+		if err != nil {
+			return err
+		}
+		if err := buf.set(index, value); err != nil {
+			return err
+		}
+		i.dlog("bset [%d] <= %d => %v", index, value, buf)
+		return nil
+	case OpBlen:
+		buf, err := i.popBuffer()
+		if err != nil {
+			return err
+		}
+		length := len(buf.bytes)
+		i.push(length)
+		i.dlog("blen %v = %d", buf, length)
+		return nil
+	case OpBstr:
+		buf, err := i.popBuffer()
+		if err != nil {
+			return err
+		}
+		str := string(buf.bytes)
+		i.push(str)
+		i.dlog("bstr %v = %q", buf, str)
+		return nil
+	case opIpushIadd:
+		return i.executeFused(op, OpIpush)
+	case opDupPut, opDupJumpLessThan:
+		return i.executeFused(op, OpDup)
+	}
+	return i.executeRegistered(op)
+}
+
+// call pushes a new frame returning to the current instruction pointer and jumps to line
+func (i *Interpreter) call(line int) error {
+	if len(i.frames) >= i.maxCallDepth {
+		return errors.Errorf("call stack overflow: exceeded max depth %d", i.maxCallDepth)
+	}
+	returnIP := i.ip
+	if err := i.jump(line); err != nil {
+		return err
+	}
+	i.frames = append(i.frames, frame{returnIP: returnIP})
+	return nil
+}
+
+// localFrame returns the current call frame after validating that
+// slot is a usable local variable slot
+func (i *Interpreter) localFrame(slot int) (*frame, error) {
+	if len(i.frames) == 0 {
+		return nil, errors.Errorf("local variable %d used outside of a call", slot)
+	}
+	if slot < 0 || slot >= maxLocals {
+		return nil, errors.Errorf("invalid local variable slot %d", slot)
+	}
+	return &i.frames[len(i.frames)-1], nil
+}
+
+// dedupStack removes consecutive duplicate values from the stack,
+// keeping the first value of each run.
+func (i *Interpreter) dedupStack() {
+	deduped := i.stack[:0]
+	for _, value := range i.stack {
+		if len(deduped) > 0 && reflect.DeepEqual(deduped[len(deduped)-1], value) {
+			continue
+		}
+		deduped = append(deduped, value)
+	}
+	i.stack = deduped
+}
+
+// checkFilePermission returns an error unless the program has been granted perm
+func (i *Interpreter) checkFilePermission(perm FilePermission) error {
+	if i.fs == nil || i.filePerm&perm == 0 {
+		return errors.New("file access denied")
+	}
+	return nil
+}
+
+// processEnv returns the environment of the current process as a map
+func processEnv() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if index := strings.Index(entry, "="); index >= 0 {
+			env[entry[:index]] = entry[index+1:]
+		}
+	}
+	return env
+}
+
+// sleep pauses for d, returning early with an error if the context is done
+func (i *Interpreter) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-i.ctx.Done():
+		return &uncatchableError{errors.Wrap(i.ctx.Err(), "sleep interrupted")}
+	}
+}
+
+func (i *Interpreter) jump(line int) error {
+	ip, err := i.lineIP(line)
+	if err != nil {
+		return err
+	}
+	i.ip = ip
+	return nil
+}
+
+// lineIP returns the instruction pointer of the 1-based line number
+func (i *Interpreter) lineIP(line int) (int, error) {
+	index := line - 1 // convert 1-based line number to 0-base jumpTable index
+	if index < 0 || index >= len(i.program.jumpTable) {
+		return 0, errors.New("invalid jump index")
+	}
+	return i.program.jumpTable[index], nil
+}
+
+// popFormatArgs consumes one value for each verb in format,
+// returning them in the order they were pushed
+func (i *Interpreter) popFormatArgs(format string) ([]interface{}, error) {
+	n := countVerbs(format)
+	if err := i.requireDepth(n); err != nil {
+		return nil, errors.Wrapf(err, "not enough values for format %q", format)
+	}
+	args := make([]interface{}, n)
+	copy(args, i.stack[len(i.stack)-n:])
+	i.stack = i.stack[:len(i.stack)-n]
+	return args, nil
+}
+
+// transformString consumes a string from the top of the stack
+// and pushes the result of applying transform to it
+func (i *Interpreter) transformString(mnemonic string, transform func(string) string) error {
+	str, err := i.popString()
+	if err != nil {
+		return err
+	}
+	result := transform(str)
+	i.push(result)
+	i.dlog("%s %q = %q", mnemonic, str, result)
+	return nil
+}
+
+// jumpIf reads a value and line number argument, consumes the top of the stack
+// and jumps to the line number if compare reports true for the two values
+func (i *Interpreter) jumpIf(mnemonic string, compare func(top, value int) bool) error {
+	value, err := i.nextInt()
+	if err != nil {
+		return err
+	}
+	line, err := i.nextInt()
+	if err != nil {
+		return err
+	}
+	top, err := i.popIntOrBool()
+	if err != nil {
+		return err
+	}
+	jumped := compare(top, value)
+	if jumped {
+		if err := i.jump(line); err != nil {
+			return err
+		}
+	}
+	i.dlog("%s %d ? %d, %d => %d jumped=%v", mnemonic, top, value, line, i.ip, jumped)
+	return nil
+}
+
+// jumpWhen reads a line number argument, consumes the top of the stack
+// and jumps to the line number if test reports true for the value
+func (i *Interpreter) jumpWhen(mnemonic string, test func(top int) bool) error {
+	line, err := i.nextInt()
+	if err != nil {
+		return err
+	}
+	top, err := i.popIntOrBool()
+	if err != nil {
+		return err
+	}
+	jumped := test(top)
+	if jumped {
+		if err := i.jump(line); err != nil {
+			return err
+		}
+	}
+	i.dlog("%s %d ? %d => %d jumped=%v", mnemonic, top, line, i.ip, jumped)
+	return nil
+}
+
+func (i *Interpreter) nextInstruction() (interface{}, error) {
+	if i.halted || i.ip == len(i.code) {
+		return nil, io.EOF
+	}
+	instruction := i.code[i.ip]
+	i.ip++
+	return instruction, nil
+}
+
+func (i *Interpreter) nextInt() (int, error) {
+	instruction, err := i.nextInstruction()
+	if err != nil {
 		return 0, err
 	}
 	return asInt(instruction)
@@ -261,6 +2441,34 @@ func (i *Interpreter) nextString() (string, error) {
 	return asString(instruction)
 }
 
+func (i *Interpreter) nextIntList() ([]int, error) {
+	instruction, err := i.nextInstruction()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := instruction.([]int)
+	if !ok {
+		return nil, errors.Errorf("value not int list: %v", instruction)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) nextFloat() (float64, error) {
+	instruction, err := i.nextInstruction()
+	if err != nil {
+		return 0, err
+	}
+	return asFloat(instruction)
+}
+
+func (i *Interpreter) nextBool() (bool, error) {
+	instruction, err := i.nextInstruction()
+	if err != nil {
+		return false, err
+	}
+	return asBool(instruction)
+}
+
 func (i *Interpreter) toStdout(args ...interface{}) (n int, err error) {
 	return fmt.Fprint(i.stdout, args...)
 }
@@ -269,6 +2477,10 @@ func (i *Interpreter) toStdoutf(format string, args ...interface{}) (n int, err
 	return fmt.Fprintf(i.stdout, format, args...)
 }
 
+func (i *Interpreter) toStderr(args ...interface{}) (n int, err error) {
+	return fmt.Fprint(i.stderr, args...)
+}
+
 func (i *Interpreter) dlog(format string, args ...interface{}) {
 	if !i.debug {
 		return
@@ -276,6 +2488,39 @@ func (i *Interpreter) dlog(format string, args ...interface{}) {
 	log.Printf(format, args...)
 }
 
+// typeName returns the name crust programs use for the type of v
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case int:
+		return "int"
+	case string:
+		return "string"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case reference:
+		return "ref"
+	case *array:
+		return "array"
+	case *dict:
+		return "map"
+	case function:
+		return "function"
+	case *channel:
+		return "channel"
+	case *big.Int:
+		return "bigint"
+	case nilValue:
+		return "nil"
+	case *record:
+		return "record"
+	case *buffer:
+		return "bytes"
+	}
+	return "unknown"
+}
+
 func asInt(v interface{}) (int, error) {
 	value, ok := v.(int)
 	if !ok {
@@ -291,3 +2536,106 @@ func asString(v interface{}) (string, error) {
 	}
 	return value, nil
 }
+
+func asFloat(v interface{}) (float64, error) {
+	value, ok := v.(float64)
+	if !ok {
+		return 0, errors.Errorf("value not float: %v", v)
+	}
+	return value, nil
+}
+
+func asReference(v interface{}) (reference, error) {
+	value, ok := v.(reference)
+	if !ok {
+		return 0, errors.Errorf("value not reference: %v", v)
+	}
+	return value, nil
+}
+
+func asArray(v interface{}) (*array, error) {
+	value, ok := v.(*array)
+	if !ok {
+		return nil, errors.Errorf("value not array: %v", v)
+	}
+	return value, nil
+}
+
+func asDict(v interface{}) (*dict, error) {
+	value, ok := v.(*dict)
+	if !ok {
+		return nil, errors.Errorf("value not map: %v", v)
+	}
+	return value, nil
+}
+
+func asFunction(v interface{}) (function, error) {
+	value, ok := v.(function)
+	if !ok {
+		return 0, errors.Errorf("value not function: %v", v)
+	}
+	return value, nil
+}
+
+func asChannel(v interface{}) (*channel, error) {
+	value, ok := v.(*channel)
+	if !ok {
+		return nil, errors.Errorf("value not channel: %v", v)
+	}
+	return value, nil
+}
+
+func asRecord(v interface{}) (*record, error) {
+	value, ok := v.(*record)
+	if !ok {
+		return nil, errors.Errorf("value not record: %v", v)
+	}
+	return value, nil
+}
+
+func asBuffer(v interface{}) (*buffer, error) {
+	value, ok := v.(*buffer)
+	if !ok {
+		return nil, errors.Errorf("value not byte buffer: %v", v)
+	}
+	return value, nil
+}
+
+// asBigInt returns v as a bigint, promoting ints
+func asBigInt(v interface{}) (*big.Int, error) {
+	switch value := v.(type) {
+	case *big.Int:
+		return value, nil
+	case int:
+		return big.NewInt(int64(value)), nil
+	}
+	return nil, errors.Errorf("value not bigint: %v", v)
+}
+
+func asBool(v interface{}) (bool, error) {
+	value, ok := v.(bool)
+	if !ok {
+		return false, errors.Errorf("value not bool: %v", v)
+	}
+	return value, nil
+}
+
+// ipow raises base to the non-negative power exp by repeated squaring
+func ipow(base, exp int) int {
+	result := 1
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
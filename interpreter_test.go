@@ -0,0 +1,93 @@
+package crust
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runSource runs the program in src and returns what it printed
+func runSource(t *testing.T, src string, opts ...InterpreterOption) (string, error) {
+	t.Helper()
+	program, err := NewProgramFromReader(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("unable to parse program: %v", err)
+	}
+	var stdout bytes.Buffer
+	opts = append([]InterpreterOption{WithStdout(&stdout)}, opts...)
+	err = NewInterpreter(program, opts...).Run()
+	return stdout.String(), err
+}
+
+func TestDedupStack(t *testing.T) {
+	program, err := NewProgramFromReader(strings.NewReader(`
+		ipush 1
+		ipush 1
+		spush a
+		spush a
+		spush a
+		ipush 1
+		ipush 2
+		ipush 2
+		dedup
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter(program)
+	if err := interpreter.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{1, "a", 1, 2}
+	if !reflect.DeepEqual(interpreter.stack, want) {
+		t.Fatalf("expected stack %v, got %v", want, interpreter.stack)
+	}
+}
+
+func TestShowInstr(t *testing.T) {
+	out, err := runSource(t, "ipush 50\njumpl 10 2\nshowinstr 2\nput")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "jumpl 10 2" {
+		t.Fatalf("expected the text of line 2, got %q", out)
+	}
+
+	_, err = runSource(t, "showinstr 9")
+	if err == nil || !strings.Contains(err.Error(), "line 9") {
+		t.Fatalf("expected an error for a line out of range, got %v", err)
+	}
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	_, err := runSource(t, "ipush 1\nipush 0\nidiv")
+	if err == nil || err.Error() != "3:1: division by zero" {
+		t.Fatalf("expected the error to be reported once at its position, got %v", err)
+	}
+}
+
+func TestRuntimeErrorLineWithoutSource(t *testing.T) {
+	program, err := NewProgramBuilder().Ipush(1).Ipush(0).Idiv().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewInterpreter(program).Run()
+	if err == nil || err.Error() != "line 3: division by zero" {
+		t.Fatalf("expected the error to be reported at its line, got %v", err)
+	}
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	_, err := runSource(t, "ipush 1\nload x")
+	if err == nil || err.Error() != "2:1: undefined variable x" {
+		t.Fatalf("expected the error to be reported once at its position, got %v", err)
+	}
+}
+
+func TestAssertFailed(t *testing.T) {
+	_, err := runSource(t, "bpush true\nassert \"holds\"\nbpush false\nassert \"positive balance\"")
+	if err == nil || err.Error() != "4:1: assertion failed: positive balance" {
+		t.Fatalf("expected the assertion message at its position, got %v", err)
+	}
+}
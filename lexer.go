@@ -0,0 +1,220 @@
+package crust
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"io"
+	"unicode"
+)
+
+// lexer splits a program into whitespace separated tokens, skipping comments
+// that run from a '#' or ';' outside of a literal to the end of the line. A
+// comment ends the token it follows.
+// A token starting with '"' is a string literal that runs to the closing quote,
+// may contain whitespace and escape sequences, and is returned unquoted.
+// A token starting with a single quote is a character literal, which is returned with its
+// quotes so that it can be told apart from a number.
+// It has the same Scan, Text and Err interface as a bufio.Scanner splitting words.
+type lexer struct {
+	r      *bufio.Reader
+	token  []rune
+	quoted bool
+	err    error
+
+	// file names the input in positions, empty if it is not a file
+	file string
+
+	// line and column are the 1-based position being read
+	// and pos is where the most recent token started
+	line   int
+	column int
+	pos    Position
+
+	// pending are tokens to return before reading further input
+	pending []token
+
+	// replayed is whether the most recent token came from pending rather than input
+	replayed bool
+}
+
+// token is a token that has already been read, along with where it was read
+type token struct {
+	text   string
+	quoted bool
+	pos    Position
+}
+
+func newLexer(r io.Reader, file string) *lexer {
+	return &lexer{r: bufio.NewReader(r), file: file, line: 1, column: 1}
+}
+
+// Scan advances to the next token, returning false at the end of input or on error
+func (l *lexer) Scan() bool {
+	l.token = l.token[:0]
+	l.quoted = false
+	l.replayed = len(l.pending) > 0
+	if l.replayed {
+		var next token
+		next, l.pending = l.pending[0], l.pending[1:]
+		l.token = append(l.token, []rune(next.text)...)
+		l.quoted = next.quoted
+		l.pos = next.pos
+		return true
+	}
+	l.pos = l.position()
+	for l.err == nil {
+		if len(l.token) == 0 {
+			l.pos = l.position()
+		}
+		c, err := l.readRune()
+		if err != nil {
+			l.err = err
+			break
+		}
+		switch {
+		case isCommentStart(c):
+			l.skipLine()
+			if len(l.token) > 0 {
+				return true
+			}
+		case len(l.token) == 0 && c == '"':
+			l.quoted = true
+			return l.scanQuoted('"', "string")
+		case len(l.token) == 0 && c == '\'':
+			l.token = append(l.token, c)
+			if !l.scanQuoted('\'', "character") {
+				return false
+			}
+			l.token = append(l.token, c)
+			return true
+		case unicode.IsSpace(c):
+			if len(l.token) > 0 {
+				return true
+			}
+		default:
+			l.token = append(l.token, c)
+		}
+	}
+	return len(l.token) > 0
+}
+
+// Text returns the most recent token read by Scan
+func (l *lexer) Text() string {
+	return string(l.token)
+}
+
+// Position returns where the most recent token started,
+// or the end of input if Scan returned false
+func (l *lexer) Position() Position {
+	return l.pos
+}
+
+// Current returns the most recent token read by Scan
+func (l *lexer) Current() token {
+	return token{text: l.Text(), quoted: l.quoted, pos: l.pos}
+}
+
+// Unread queues tokens to be returned by Scan, in order, before any further input
+func (l *lexer) Unread(tokens []token) {
+	l.pending = append(append([]token(nil), tokens...), l.pending...)
+}
+
+// Replayed reports whether the most recent token was queued by Unread
+func (l *lexer) Replayed() bool {
+	return l.replayed
+}
+
+// Quoted reports whether the most recent token was a string literal
+func (l *lexer) Quoted() bool {
+	return l.quoted
+}
+
+// Err returns the first non-EOF error encountered by the lexer
+func (l *lexer) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// scanQuoted reads the rest of a kind of literal after its opening quote,
+// appending its unescaped contents to the token
+func (l *lexer) scanQuoted(quote rune, kind string) bool {
+	for {
+		c, err := l.readRune()
+		if err != nil {
+			if err == io.EOF {
+				err = errors.Errorf("unterminated %s literal", kind)
+			}
+			l.err = err
+			return false
+		}
+		switch c {
+		case quote:
+			return true
+		case '\\':
+			escaped, err := l.readRune()
+			if err != nil {
+				l.err = errors.Errorf("unterminated %s literal", kind)
+				return false
+			}
+			unescaped, ok := escapes[escaped]
+			if !ok {
+				l.err = errors.Errorf("invalid escape sequence \\%c", escaped)
+				return false
+			}
+			l.token = append(l.token, unescaped)
+		default:
+			l.token = append(l.token, c)
+		}
+	}
+}
+
+// escapes maps the character following a backslash in a string literal to the character it stands for
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// position returns the position of the next character of input
+func (l *lexer) position() Position {
+	return Position{File: l.file, Line: l.line, Column: l.column}
+}
+
+// readRune reads the next character of input, advancing the position
+func (l *lexer) readRune() (rune, error) {
+	c, _, err := l.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return c, nil
+}
+
+// skipLine discards input through the end of the current line
+func (l *lexer) skipLine() {
+	for {
+		c, err := l.readRune()
+		if err != nil {
+			l.err = err
+			return
+		}
+		if c == '\n' {
+			return
+		}
+	}
+}
+
+func isCommentStart(c rune) bool {
+	return c == '#' || c == ';'
+}
@@ -0,0 +1,23 @@
+package crust
+
+import (
+	"testing"
+)
+
+func TestCommentEndsToken(t *testing.T) {
+	tests := map[string]string{
+		"ipush 1;c\nput":        "1",
+		"ipush 2#c\nput#c":      "2",
+		"spush \"a;b\"#c\nput":  "a;b",
+		"ipush 3 ;c\nput ; end": "3",
+	}
+	for src, want := range tests {
+		out, err := runSource(t, src)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if out != want {
+			t.Fatalf("%q: expected %q, got %q", src, want, out)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"os"
+)
+
+// Unit is a separately parsed part of a program. Its labels are symbols that
+// the units it is linked with can refer to, and it can refer to theirs.
+type Unit struct {
+	program *Program
+
+	// labels maps the unit's label names to their 1-based line numbers in the unit
+	labels map[string]int
+}
+
+// NewUnitFromFile reads a unit from disk for linking
+func NewUnitFromFile(path string, opts ...ProgramOption) (*Unit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open unit file")
+	}
+	defer f.Close()
+	unit, err := parseUnit(f, path, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse unit")
+	}
+	return unit, nil
+}
+
+// NewUnitFromReader reads a unit from a reader for linking
+func NewUnitFromReader(r io.Reader, opts ...ProgramOption) (*Unit, error) {
+	unit, err := parseUnit(r, "", opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse unit")
+	}
+	return unit, nil
+}
+
+// Link combines units into a single program, in order. Line numbers written in
+// each unit are moved to where the unit is placed in the program. A label is
+// local to the unit defining it unless the unit exports it with .export, in
+// which case other units can refer to it after declaring it with .extern. Line
+// numbers that a unit computes at runtime, such as those pushed for jumpd, are
+// not relocated. The program's AST keeps each unit's instructions as written,
+// and the labels each unit defines are moved with it.
+func Link(units []*Unit) (*Program, error) {
+	program := &Program{}
+	globals := make(map[string]int)
+	owners := make(map[string]int)
+	entryUnit := -1
+	lineOffsets := make([]int, len(units))
+	ipOffsets := make([]int, len(units))
+
+	for unitIndex, unit := range units {
+		lineOffset := len(program.jumpTable)
+		ipOffset := len(program.instructions)
+		constOffset := len(program.constants)
+		lineOffsets[unitIndex] = lineOffset
+		ipOffsets[unitIndex] = ipOffset
+
+		if unit.program.entry != 0 {
+			if entryUnit >= 0 {
+				return nil, errors.Errorf("entry points declared in units %d and %d", entryUnit, unitIndex)
+			}
+			entryUnit = unitIndex
+			program.entry = unit.program.entry + lineOffset
+		}
+
+		for _, symbol := range unit.program.symbols {
+			if symbol.Extern {
+				continue
+			}
+			if owner, ok := owners[symbol.Name]; ok {
+				return nil, errors.Errorf("duplicate symbol %s in units %d and %d", symbol.Name, owner, unitIndex)
+			}
+			symbol.Line += lineOffset
+			globals[symbol.Name] = symbol.Line
+			owners[symbol.Name] = unitIndex
+			program.symbols = append(program.symbols, symbol)
+		}
+
+		instructions := append([]interface{}(nil), unit.program.instructions...)
+		relocated := &Program{instructions: instructions}
+		relocated.eachArgument(func(op OpCode, index int, argType ArgType) {
+			switch value := instructions[index].(type) {
+			case int:
+				if argType == ArgLine {
+					instructions[index] = value + lineOffset
+				} else if op == OpLoadc {
+					instructions[index] = value + constOffset
+				}
+			case []int:
+				if op == OpJumpTable {
+					lines := make([]int, len(value))
+					for i, line := range value {
+						lines[i] = line + lineOffset
+					}
+					instructions[index] = lines
+				}
+			case lineListRef:
+				lines := make(lineListRef, len(value))
+				for i, line := range value {
+					if line, ok := line.(int); ok {
+						lines[i] = line + lineOffset
+						continue
+					}
+					lines[i] = line
+				}
+				instructions[index] = lines
+			}
+		})
+		program.instructions = append(program.instructions, instructions...)
+
+		for _, ip := range unit.program.jumpTable {
+			program.jumpTable = append(program.jumpTable, ip+ipOffset)
+		}
+		for _, mark := range unit.program.marks {
+			mark.ip += ipOffset
+			program.marks = append(program.marks, mark)
+		}
+		for _, source := range unit.program.sourceMap {
+			source.ip += ipOffset
+			program.sourceMap = append(program.sourceMap, source)
+		}
+		for _, label := range unit.program.labels {
+			label.line += lineOffset
+			program.labels = append(program.labels, label)
+		}
+		program.constants = append(program.constants, unit.program.constants...)
+		program.ast = append(program.ast, unit.program.ast...)
+	}
+
+	for unitIndex, unit := range units {
+		start := ipOffsets[unitIndex]
+		for index := start; index < start+len(unit.program.instructions); index++ {
+			resolved, err := resolveRefs(program.instructions[index], func(ref labelRef) (int, error) {
+				return unit.resolve(ref, lineOffsets[unitIndex], globals)
+			})
+			if err != nil {
+				return nil, err
+			}
+			program.instructions[index] = resolved
+		}
+	}
+	return program, nil
+}
+
+// resolve returns the line number of the linked program that a label reference
+// in the unit refers to, either a label of the unit itself, placed at lineOffset,
+// or a label exported by another unit
+func (u *Unit) resolve(ref labelRef, lineOffset int, globals map[string]int) (int, error) {
+	if line, ok := u.labels[ref.name]; ok {
+		return line + lineOffset, nil
+	}
+	for _, symbol := range u.program.symbols {
+		if symbol.Extern && symbol.Name == ref.name {
+			line, ok := globals[ref.name]
+			if !ok {
+				return 0, errors.Errorf("undefined symbol %s at %v", ref.name, ref.pos)
+			}
+			return line, nil
+		}
+	}
+	return 0, errors.Errorf("undefined label %s at %v, declare it with .extern to use another unit's export", ref.name, ref.pos)
+}
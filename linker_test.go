@@ -0,0 +1,88 @@
+package crust
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// linkSources parses each source as a unit and links them in order
+func linkSources(t *testing.T, sources ...string) *Program {
+	t.Helper()
+	var units []*Unit
+	for _, src := range sources {
+		unit, err := NewUnitFromReader(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, unit)
+	}
+	program, err := Link(units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestLinkRelocation(t *testing.T) {
+	tests := map[string]struct {
+		sources []string
+		want    string
+	}{
+		"lines": {
+			sources: []string{"spush a\nput", "jump 3\nspush skipped\nspush b\nput"},
+			want:    "ab",
+		},
+		"constants": {
+			sources: []string{".data\nstring a\n.text\nloadc 0\nput", ".data\nstring b\n.text\nloadc 0\nput"},
+			want:    "ab",
+		},
+	}
+	for name, test := range tests {
+		program := linkSources(t, test.sources...)
+		var stdout bytes.Buffer
+		if err := NewInterpreter(program, WithStdout(&stdout)).Run(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if stdout.String() != test.want {
+			t.Fatalf("%s: expected %q, got %q", name, test.want, stdout.String())
+		}
+	}
+}
+
+func TestLinkLabels(t *testing.T) {
+	program := linkSources(t, "first: nop\nnop", "nop\nsecond: jump second")
+	var lines []int
+	for _, label := range program.labels {
+		lines = append(lines, label.line)
+	}
+	if want := []int{1, 4}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected labels at lines %v, got %v", want, lines)
+	}
+}
+
+func TestLinkJumpTableLabels(t *testing.T) {
+	var units []*Unit
+	for _, src := range []string{
+		"spush a\nput",
+		"ipush 0\njtable 1 shout quiet\nquiet: halt 0\nshout: spush b\nput",
+	} {
+		unit, err := NewUnitFromReader(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, unit)
+	}
+	program, err := Link(units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	if err := NewInterpreter(program, WithStdout(&stdout)).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "ab" {
+		t.Fatalf("expected the jump to the label of the second unit, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,191 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// LintRule is a check of a program that Lint runs
+type LintRule interface {
+	// Name identifies the rule in the diagnostics it reports
+	Name() string
+
+	// Check returns the problems the rule finds in the program. It is given
+	// programs whose instructions decode, which may still fail Verify.
+	Check(*Program) []Diagnostic
+}
+
+// LintFunc returns a LintRule with the given name that runs check
+func LintFunc(name string, check func(*Program) []Diagnostic) LintRule {
+	return funcRule{name: name, check: check}
+}
+
+type funcRule struct {
+	name  string
+	check func(*Program) []Diagnostic
+}
+
+func (f funcRule) Name() string {
+	return f.name
+}
+
+func (f funcRule) Check(program *Program) []Diagnostic {
+	return f.check(program)
+}
+
+// The built in lint rules
+var (
+	UnusedLabelRule     = LintFunc("unused-label", lintUnusedLabels)
+	UnreachableCodeRule = LintFunc("unreachable-code", lintUnreachableCode)
+	UnusedPushRule      = LintFunc("unused-push", lintUnusedPushes)
+	JumpIntoArgsRule    = LintFunc("jump-into-args", lintJumpsIntoArgs)
+)
+
+// DefaultLintRules are the rules Lint runs when it is given none
+var DefaultLintRules = []LintRule{UnusedLabelRule, UnreachableCodeRule, UnusedPushRule, JumpIntoArgsRule}
+
+// Lint checks the program with each of the rules, or with DefaultLintRules if
+// none are given, returning what they find ordered by instruction position.
+// Each diagnostic is named by the rule that reported it. It returns an error if
+// the program's instructions cannot be decoded.
+func Lint(program *Program, rules ...LintRule) ([]Diagnostic, error) {
+	if err := program.decode(func(int, OpCode, instructionSignature) error { return nil }); err != nil {
+		return nil, errors.Wrap(err, "unable to lint program")
+	}
+	if len(rules) == 0 {
+		rules = DefaultLintRules
+	}
+	var diagnostics []Diagnostic
+	for _, rule := range rules {
+		for _, d := range rule.Check(program) {
+			d.Rule = rule.Name()
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	sortDiagnostics(diagnostics)
+	return diagnostics, nil
+}
+
+// lintUnusedLabels reports labels that no instruction or directive refers to.
+// Only programs parsed from source keep their labels.
+func lintUnusedLabels(program *Program) []Diagnostic {
+	used := make(map[string]bool)
+	for _, node := range program.ast {
+		for _, arg := range node.Args {
+			if label, ok := arg.(Label); ok {
+				used[string(label)] = true
+			}
+			if lines, ok := arg.([]interface{}); ok {
+				for _, line := range lines {
+					if label, ok := line.(Label); ok {
+						used[string(label)] = true
+					}
+				}
+			}
+		}
+	}
+	for _, symbol := range program.symbols {
+		used[symbol.Name] = true
+	}
+	var diagnostics []Diagnostic
+	for _, label := range program.labels {
+		if used[label.name] || (program.entry != 0 && label.line == program.entry) {
+			continue
+		}
+		ip := len(program.instructions)
+		if start, ok := program.lineStart(label.line); ok {
+			ip = start
+		}
+		d := program.diagnostic(ip, "label %s is never used", label.name)
+		d.Line, d.Position = label.line, label.pos
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// lintUnreachableCode reports the first instruction of each run of
+// instructions that EliminateDeadCode would remove
+func lintUnreachableCode(program *Program) []Diagnostic {
+	cfg, err := AnalyzeCFG(program)
+	if err != nil {
+		return nil
+	}
+	live := program.liveBlocks(cfg)
+	if live == nil {
+		return nil
+	}
+	var diagnostics []Diagnostic
+	for index, block := range cfg.Blocks {
+		if !live[index] && (index == 0 || live[index-1]) {
+			diagnostics = append(diagnostics, program.diagnostic(block.Start, "unreachable code"))
+		}
+	}
+	return diagnostics
+}
+
+// lintUnusedPushes reports instructions that push a value which the next
+// instruction discards, or which is left behind when the program ends
+func lintUnusedPushes(program *Program) []Diagnostic {
+	var diagnostics []Diagnostic
+	previous, previousIP := OpCode(0), -1
+	report := func() {
+		if previousIP >= 0 && pushes[previous] {
+			diagnostics = append(diagnostics, program.diagnostic(previousIP, "value pushed by %s is never used", opMnemonics()[previous]))
+		}
+	}
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		switch op {
+		case OpDrop, OpClear, OpHalt:
+			report()
+		}
+		previous, previousIP = op, ip
+		return nil
+	})
+	report()
+	return diagnostics
+}
+
+// lintJumpsIntoArgs reports line numbers, written as arguments or pushed for
+// jumpd, whose line starts inside the arguments of an instruction rather than
+// at an op code. Verify rejects such programs, which would run the arguments.
+func lintJumpsIntoArgs(program *Program) []Diagnostic {
+	starts := map[int]bool{len(program.instructions): true}
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		starts[ip] = true
+		return nil
+	})
+	var diagnostics []Diagnostic
+	check := func(ip int, op OpCode, line interface{}) {
+		n, ok := line.(int)
+		if !ok {
+			return
+		}
+		if target, ok := program.lineStart(n); ok && !starts[target] {
+			diagnostics = append(diagnostics, program.diagnostic(ip, "%s refers to line %d, which starts inside the arguments of an instruction", opMnemonics()[op], n))
+		}
+	}
+	previous, previousIP := OpCode(0), -1
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		for index, argType := range signature.args {
+			arg := program.instructions[ip+1+index]
+			switch {
+			case argType == ArgLine:
+				check(ip, op, arg)
+			case argType == ArgIntList && op == OpJumpTable:
+				lines, _ := arg.([]int)
+				for _, line := range lines {
+					check(ip, op, line)
+				}
+			case op == OpJrel && index == 0, op == OpJrell && index == 1:
+				if offset, ok := arg.(int); ok {
+					check(ip, op, program.lineOf(ip)+offset)
+				}
+			}
+		}
+		if op == OpJumpDynamic && previous == OpIpush {
+			check(ip, op, program.instructions[previousIP+1])
+		}
+		previous, previousIP = op, ip
+		return nil
+	})
+	return diagnostics
+}
@@ -0,0 +1,50 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseIntLiteral parses an int argument written in decimal, in hexadecimal
+// with a 0x prefix or in binary with a 0b prefix, optionally preceded by a sign,
+// or as a quoted character literal standing for its code point
+func parseIntLiteral(token string) (int, error) {
+	if strings.HasPrefix(token, "'") {
+		return parseCharLiteral(token)
+	}
+	sign, digits := "", token
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0X"):
+		base, digits = 16, digits[2:]
+	case strings.HasPrefix(digits, "0b"), strings.HasPrefix(digits, "0B"):
+		base, digits = 2, digits[2:]
+	}
+	if digits == "" || strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		return 0, errors.Errorf("invalid integer literal %q", token)
+	}
+	value, err := strconv.ParseInt(sign+digits, base, strconv.IntSize)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, errors.Errorf("integer literal %s out of range", token)
+		}
+		return 0, errors.Errorf("invalid integer literal %q", token)
+	}
+	return int(value), nil
+}
+
+// parseCharLiteral parses a character literal such as 'a', as produced by the
+// lexer with its escape sequences already replaced, into its code point
+func parseCharLiteral(token string) (int, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(token, "'"), "'")
+	if len(token) < 2 || !strings.HasSuffix(token, "'") || utf8.RuneCountInString(inner) != 1 {
+		return 0, errors.Errorf("invalid character literal %s", token)
+	}
+	c, _ := utf8.DecodeRuneInString(inner)
+	return int(c), nil
+}
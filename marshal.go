@@ -0,0 +1,209 @@
+package crust
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// jsonProgram is the JSON form of a program
+type jsonProgram struct {
+	Entry        int               `json:"entry,omitempty"`
+	Constants    []jsonConstant    `json:"constants"`
+	Instructions []jsonInstruction `json:"instructions"`
+	JumpTable    []int             `json:"jumpTable"`
+	Symbols      []jsonSymbol      `json:"symbols,omitempty"`
+	Marks        []jsonMark        `json:"marks,omitempty"`
+}
+
+// jsonConstant is a constant pool value with the type it is declared with in a .data section
+type jsonConstant struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonInstruction is an op code and its arguments. IP is the instruction's
+// position in the instruction stream, which the jump table refers to.
+// It is written for readers and recomputed when decoding.
+type jsonInstruction struct {
+	IP   int               `json:"ip"`
+	Op   string            `json:"op"`
+	Args []json.RawMessage `json:"args,omitempty"`
+}
+
+// jsonSymbol is an exported or extern symbol
+type jsonSymbol struct {
+	Name   string `json:"name"`
+	Line   int    `json:"line,omitempty"`
+	Extern bool   `json:"extern,omitempty"`
+}
+
+// jsonMark is the source declared by a .line directive for the instructions from IP on
+type jsonMark struct {
+	IP   int    `json:"ip"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// MarshalJSON encodes the program's constant pool, instruction stream, jump
+// table, symbols and .line marks as JSON. Instructions are written by mnemonic
+// with their arguments, and bigint values are written as decimal strings.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	out := jsonProgram{
+		Entry:        p.entry,
+		Constants:    make([]jsonConstant, 0, len(p.constants)),
+		Instructions: make([]jsonInstruction, 0),
+		JumpTable:    append([]int{}, p.jumpTable...),
+	}
+	for index, value := range p.constants {
+		kind, ok := dataKind(value)
+		if !ok {
+			return nil, errors.Errorf("invalid constant %d: %v", index, value)
+		}
+		raw, err := marshalArg(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to marshal constant %d", index)
+		}
+		out.Constants = append(out.Constants, jsonConstant{Type: kind, Value: raw})
+	}
+	err := p.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		instruction := jsonInstruction{IP: ip, Op: opMnemonics()[op]}
+		for index := range signature.args {
+			raw, err := marshalArg(p.instructions[ip+1+index])
+			if err != nil {
+				return errors.Wrapf(err, "unable to marshal argument of %s at ip %d", instruction.Op, ip)
+			}
+			instruction.Args = append(instruction.Args, raw)
+		}
+		out.Instructions = append(out.Instructions, instruction)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range p.symbols {
+		out.Symbols = append(out.Symbols, jsonSymbol(symbol))
+	}
+	for _, mark := range p.marks {
+		out.Marks = append(out.Marks, jsonMark{IP: mark.ip, File: mark.file, Line: mark.line})
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var in jsonProgram
+	if err := json.Unmarshal(data, &in); err != nil {
+		return errors.Wrap(err, "unable to unmarshal program")
+	}
+	program := &Program{
+		entry:        in.Entry,
+		constants:    make([]interface{}, 0, len(in.Constants)),
+		instructions: make([]interface{}, 0),
+		jumpTable:    append([]int{}, in.JumpTable...),
+	}
+	for index, constant := range in.Constants {
+		argType, ok := constantTypes[constant.Type]
+		if !ok {
+			return errors.Errorf("invalid constant type %s", constant.Type)
+		}
+		value, err := unmarshalArg(argType, constant.Value)
+		if err != nil {
+			return errors.Wrapf(err, "unable to unmarshal constant %d", index)
+		}
+		program.constants = append(program.constants, value)
+	}
+	for _, instruction := range in.Instructions {
+		signature, ok := instructionSignatures()[instruction.Op]
+		if !ok {
+			return errors.Errorf("invalid instruction %s", instruction.Op)
+		}
+		if len(instruction.Args) != len(signature.args) {
+			return errors.Errorf("%s takes %d arguments, got %d", instruction.Op, len(signature.args), len(instruction.Args))
+		}
+		program.instructions = append(program.instructions, signature.op)
+		for index, argType := range signature.args {
+			value, err := unmarshalArg(argType, instruction.Args[index])
+			if err != nil {
+				return errors.Wrapf(err, "%s argument %d", instruction.Op, index+1)
+			}
+			program.instructions = append(program.instructions, value)
+		}
+	}
+	for _, symbol := range in.Symbols {
+		program.symbols = append(program.symbols, Symbol(symbol))
+	}
+	for _, mark := range in.Marks {
+		program.marks = append(program.marks, sourceMark{ip: mark.IP, file: mark.File, line: mark.Line})
+	}
+	if err := Verify(program); err != nil {
+		return errors.Wrap(err, "unable to unmarshal program")
+	}
+	*p = *program
+	return nil
+}
+
+// GobEncode encodes the program for encoding/gob in the format written by Encode
+func (p *Program) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes a program encoded by GobEncode
+func (p *Program) GobDecode(data []byte) error {
+	program, err := DecodeProgram(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*p = *program
+	return nil
+}
+
+// marshalArg encodes an argument or constant as JSON
+func marshalArg(value interface{}) (json.RawMessage, error) {
+	if v, ok := value.(*big.Int); ok {
+		value = v.String()
+	}
+	return json.Marshal(value)
+}
+
+// unmarshalArg decodes an argument or constant of the given type from JSON
+func unmarshalArg(argType ArgType, raw json.RawMessage) (interface{}, error) {
+	switch argType {
+	case ArgInt, ArgLine:
+		var value int
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ArgString:
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ArgFloat:
+		var value float64
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ArgBool:
+		var value bool
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ArgIntList:
+		value := []int{}
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ArgBigInt:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		value, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return nil, errors.Errorf("invalid bigint %s", text)
+		}
+		return value, nil
+	}
+	return nil, errors.Errorf("unknown argument type %d", argType)
+}
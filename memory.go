@@ -0,0 +1,21 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// WithMemory gives the program a flat memory of size int cells, addressed
+// from 0, for mload and mstore instructions. Programs have no memory by default.
+func WithMemory(size int) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.memory = make([]int, size)
+	}
+}
+
+// checkAddress returns an error if addr is outside of the flat memory
+func (i *Interpreter) checkAddress(addr int) error {
+	if addr < 0 || addr >= len(i.memory) {
+		return errors.Errorf("memory address %d out of range [0, %d)", addr, len(i.memory))
+	}
+	return nil
+}
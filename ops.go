@@ -3,18 +3,185 @@ package crust
 type OpCode byte
 
 const (
-	OpPutln        = OpCode(1) // (), print '\n' to stdout
-	OpDup          = OpCode(2) // (), duplicate the top of the stack
-	OpPut          = OpCode(3) // (), consume and print top of stack to stdout
-	OpJump         = OpCode(4) // (line:int), jump to line number
-	OpJumpLessThan = OpCode(5) // (value:int, line:int), if the consumed top of stack is less than value, jump to line number
+	OpPutln        = OpCode(1)  // (), print '\n' to stdout
+	OpDup          = OpCode(2)  // (), duplicate the top of the stack
+	OpPut          = OpCode(3)  // (), consume and print top of stack to stdout
+	OpJump         = OpCode(4)  // (line:int), jump to line number
+	OpJumpLessThan = OpCode(5)  // (value:int, line:int), if the consumed top of stack is less than value, jump to line number
+	OpDedupStack   = OpCode(6)  // (), collapse runs of consecutive equal values on the stack into a single value
+	OpShowInstr    = OpCode(7)  // (line:int), push the text of the instruction at line number
+	OpHalt         = OpCode(8)  // (status:int), stop the program with the exit status
+	OpNop          = OpCode(9)  // (), do nothing
+	OpLoadc        = OpCode(10) // (index:int), push the constant at index of the program's data section onto stack
 
-	OpIpush     = OpCode(11) // (value:int), push value onto stack
-	OpIadd      = OpCode(12) // (), consume top two values of stack, push sum onto stack
-	OpIsubtract = OpCode(14) // (), consume top two values of stack, push (top-1) - (top) onto stack
+	OpIpush      = OpCode(11) // (value:int), push value onto stack
+	OpIadd       = OpCode(12) // (), consume top two values of stack, push sum onto stack
+	OpImultiply  = OpCode(13) // (), consume top two values of stack, push product onto stack
+	OpIsubtract  = OpCode(14) // (), consume top two values of stack, push (top-1) - (top) onto stack
+	OpIdivide    = OpCode(15) // (), consume top two values of stack, push (top-1) / (top) onto stack
+	OpImodulo    = OpCode(16) // (), consume top two values of stack, push (top-1) % (top) onto stack
+	OpInegate    = OpCode(17) // (), consume top of stack, push its negation onto stack
+	OpIabsolute  = OpCode(18) // (), consume top of stack, push its absolute value onto stack
+	OpIincrement = OpCode(19) // (value:int), add value to the int on top of stack in place
 
 	OpSpush = OpCode(21) // (value:string), push value onto stack
 	OpSadd  = OpCode(22) // (), consume top two values of stack, push concatenation onto stack
+	OpSsub  = OpCode(23) // (), consume an end index, start index and string from top of stack, push the runes [start, end) onto stack
+	OpSchar = OpCode(24) // (), consume an index then a string from top of stack, push the rune at index as a string onto stack
+	OpSlen  = OpCode(25) // (), consume a string from top of stack, push its length in runes onto stack
+	OpSblen = OpCode(26) // (), consume a string from top of stack, push its length in bytes onto stack
+	OpSeq   = OpCode(27) // (), consume top two strings of stack, push whether they are equal onto stack
+	OpScmp  = OpCode(28) // (), consume top two strings of stack, push -1, 0 or 1 as (top-1) orders before, equal to or after (top) onto stack
+
+	OpFpush     = OpCode(31) // (value:float), push value onto stack
+	OpFadd      = OpCode(32) // (), consume top two values of stack, push sum onto stack
+	OpFsubtract = OpCode(33) // (), consume top two values of stack, push (top-1) - (top) onto stack
+	OpFmultiply = OpCode(34) // (), consume top two values of stack, push product onto stack
+	OpFdivide   = OpCode(35) // (), consume top two values of stack, push (top-1) / (top) onto stack
+
+	OpBand       = OpCode(41) // (), consume top two values of stack, push bitwise and onto stack
+	OpBor        = OpCode(42) // (), consume top two values of stack, push bitwise or onto stack
+	OpBxor       = OpCode(43) // (), consume top two values of stack, push bitwise exclusive or onto stack
+	OpBnot       = OpCode(44) // (), consume top of stack, push its bitwise complement onto stack
+	OpShiftLeft  = OpCode(45) // (), consume top two values of stack, push (top-1) << (top) onto stack
+	OpShiftRight = OpCode(46) // (), consume top two values of stack, push (top-1) >> (top) onto stack
+
+	OpIequal        = OpCode(51) // (), consume top two values of stack, push whether (top-1) == (top) onto stack
+	OpInotEqual     = OpCode(52) // (), consume top two values of stack, push whether (top-1) != (top) onto stack
+	OpIlessThan     = OpCode(53) // (), consume top two values of stack, push whether (top-1) < (top) onto stack
+	OpIlessEqual    = OpCode(54) // (), consume top two values of stack, push whether (top-1) <= (top) onto stack
+	OpIgreaterThan  = OpCode(55) // (), consume top two values of stack, push whether (top-1) > (top) onto stack
+	OpIgreaterEqual = OpCode(56) // (), consume top two values of stack, push whether (top-1) >= (top) onto stack
+
+	OpBpush = OpCode(61) // (value:bool), push value onto stack
+	OpAnd   = OpCode(62) // (), consume top two values of stack, push logical and onto stack
+	OpOr    = OpCode(63) // (), consume top two values of stack, push logical or onto stack
+	OpNot   = OpCode(64) // (), consume top of stack, push its logical negation onto stack
+
+	OpJumpEqual        = OpCode(71) // (value:int, line:int), if the consumed top of stack is equal to value, jump to line number
+	OpJumpNotEqual     = OpCode(72) // (value:int, line:int), if the consumed top of stack is not equal to value, jump to line number
+	OpJumpGreaterThan  = OpCode(73) // (value:int, line:int), if the consumed top of stack is greater than value, jump to line number
+	OpJumpGreaterEqual = OpCode(74) // (value:int, line:int), if the consumed top of stack is greater than or equal to value, jump to line number
+	OpJumpLessEqual    = OpCode(75) // (value:int, line:int), if the consumed top of stack is less than or equal to value, jump to line number
+	OpJumpZero         = OpCode(76) // (line:int), if the consumed top of stack is zero or false, jump to line number
+	OpJumpNotZero      = OpCode(77) // (line:int), if the consumed top of stack is nonzero or true, jump to line number
+	OpJumpDynamic      = OpCode(78) // (), consume a line number from top of stack and jump to it
+	OpJumpTable        = OpCode(79) // (lines:[]int, default:int), consume an index from top of stack, jump to the line number at index of lines, or default if out of range
+
+	OpSwap  = OpCode(81) // (), exchange the top two values of the stack
+	OpOver  = OpCode(82) // (), push a copy of the second value of the stack
+	OpRot   = OpCode(83) // (), rotate the top three values of the stack, moving the third value to the top
+	OpDrop  = OpCode(84) // (), consume and discard the top of the stack
+	OpPick  = OpCode(85) // (n:int), push a copy of the nth value of the stack, counting from 0 at the top
+	OpDepth = OpCode(86) // (), push the number of values on the stack
+	OpClear = OpCode(87) // (), discard every value on the stack
+	OpDupn  = OpCode(88) // (n:int), push copies of the top n values of the stack, preserving their order
+
+	OpCall     = OpCode(91) // (line:int), save the return position on the call stack and jump to line number
+	OpReturn   = OpCode(92) // (), return to the position saved by the most recent call
+	OpLoadl    = OpCode(93) // (slot:int), push the value of the current call frame's local variable slot
+	OpStorel   = OpCode(94) // (slot:int), consume top of stack and store it in the current call frame's local variable slot
+	OpTailCall = OpCode(95) // (line:int), replace the current call frame with a call to line number, keeping its return position
+	OpCpush    = OpCode(96) // (line:int), push a function that calls line number onto stack
+	OpCalli    = OpCode(97) // (), consume a function from top of stack and call it
+	OpSpawn    = OpCode(98) // (line:int), start a coroutine that calls line number, finishing when it returns
+	OpYield    = OpCode(99) // (), pause the current coroutine and resume the next waiting coroutine
+
+	OpGload  = OpCode(101) // (slot:int), push the value of the global variable slot
+	OpGstore = OpCode(102) // (slot:int), consume top of stack and store it in the global variable slot
+	OpLoad   = OpCode(103) // (name:string), push the value of the named variable
+	OpStore  = OpCode(104) // (name:string), consume top of stack and store it in the named variable
+
+	OpAlloc  = OpCode(111) // (), allocate an empty heap cell, push a reference to it onto stack
+	OpFree   = OpCode(112) // (), consume a reference from top of stack and free its heap cell
+	OpRload  = OpCode(113) // (), consume a reference from top of stack, push the value of its heap cell onto stack
+	OpRstore = OpCode(114) // (), consume a value then a reference from top of stack, store the value in the reference's heap cell
+	OpMload  = OpCode(115) // (addr:int), push the int at addr of flat memory onto stack
+	OpMstore = OpCode(116) // (addr:int), consume an int from top of stack and store it at addr of flat memory
+
+	OpAnew  = OpCode(121) // (), push a new empty array onto stack
+	OpAget  = OpCode(122) // (), consume an index then an array from top of stack, push the array's value at index onto stack
+	OpAset  = OpCode(123) // (), consume a value then an index from top of stack, store the value at index of the array left on top of stack
+	OpAlen  = OpCode(124) // (), consume an array from top of stack, push its length onto stack
+	OpApush = OpCode(125) // (), consume a value from top of stack, append it to the array left on top of stack
+
+	OpMnew = OpCode(131) // (), push a new empty map onto stack
+	OpMget = OpCode(132) // (), consume a key then a map from top of stack, push the map's value for key onto stack
+	OpMset = OpCode(133) // (), consume a value then a key from top of stack, store the value for key in the map left on top of stack
+	OpMhas = OpCode(134) // (), consume a key then a map from top of stack, push whether the map contains key onto stack
+	OpMdel = OpCode(135) // (), consume a key from top of stack, delete key from the map left on top of stack
+	OpMlen = OpCode(136) // (), consume a map from top of stack, push its number of keys onto stack
+
+	OpSupper   = OpCode(141) // (), consume a string from top of stack, push it in upper case onto stack
+	OpSlower   = OpCode(142) // (), consume a string from top of stack, push it in lower case onto stack
+	OpStrim    = OpCode(143) // (), consume a string from top of stack, push it without leading and trailing whitespace onto stack
+	OpSsplit   = OpCode(144) // (), consume a separator then a string from top of stack, push an array of the separated parts onto stack
+	OpSjoin    = OpCode(145) // (), consume a separator then an array of strings from top of stack, push the joined string onto stack
+	OpSfind    = OpCode(146) // (), consume a substring then a string from top of stack, push the rune index of the first occurrence or -1 onto stack
+	OpSreplace = OpCode(147) // (), consume a replacement, substring and string from top of stack, push the string with every substring replaced onto stack
+	OpSfmt     = OpCode(148) // (format:string), consume one value per format verb from top of stack, push the formatted string onto stack
+	OpSbytes   = OpCode(149) // (), consume a string from top of stack, push a byte buffer holding a copy of its bytes onto stack
+
+	OpPutf     = OpCode(151) // (format:string), consume one value per format verb from top of stack and print them formatted to stdout
+	OpReadi    = OpCode(152) // (), read a whitespace separated int from stdin, push it onto stack
+	OpReads    = OpCode(153) // (), read a whitespace separated word from stdin, push it onto stack
+	OpReadline = OpCode(154) // (), read a whole line from stdin, push it without its line ending onto stack
+	OpEput     = OpCode(155) // (), consume and print top of stack to stderr
+	OpEputln   = OpCode(156) // (), print '\n' to stderr
+
+	OpItos   = OpCode(161) // (), consume an int from top of stack, push its decimal string onto stack
+	OpStoi   = OpCode(162) // (), consume a decimal string from top of stack, push its int value onto stack
+	OpChr    = OpCode(163) // (), consume a code point from top of stack, push it as a single rune string onto stack
+	OpOrd    = OpCode(164) // (), consume a string from top of stack, push the code point of its first rune onto stack
+	OpTypeof = OpCode(165) // (), push the type name of the top of stack onto stack
+
+	OpAssert = OpCode(171) // (message:string), consume top of stack, fail the program with message if it is zero or false
+	OpBrk    = OpCode(172) // (), pause execution and invoke the breakpoint handler
+	OpBtrace = OpCode(173) // (), push an array describing the call stack, innermost position first, onto stack
+
+	OpTry    = OpCode(181) // (line:int), install an exception handler that resumes at line number with the exception on top of stack
+	OpThrow  = OpCode(182) // (), consume top of stack and throw it to the most recent exception handler
+	OpEndTry = OpCode(183) // (), remove the most recent exception handler
+
+	OpRand     = OpCode(191) // (), consume n from top of stack, push a random int in [0, n) onto stack
+	OpNow      = OpCode(192) // (), push the current unix time in milliseconds onto stack
+	OpElapsed  = OpCode(193) // (), push the milliseconds elapsed since the interpreter was created onto stack
+	OpSleep    = OpCode(194) // (ms:int), pause the program for ms milliseconds
+	OpGetenv   = OpCode(195) // (name:string), push the value of the environment variable, or an empty string if unset, onto stack
+	OpFread    = OpCode(196) // (), consume a path from top of stack, push the contents of the file onto stack
+	OpFwrite   = OpCode(197) // (), consume contents then a path from top of stack, write the contents to the file
+	OpHostcall = OpCode(198) // (name:string, argc:int), consume argc values from top of stack, call the registered host function name with them and push its results onto stack
+	OpSys      = OpCode(199) // (n:int), consume the arguments of syscall slot n from top of stack, call it and push its results onto stack
+
+	OpChnew  = OpCode(201) // (capacity:int), push a new channel buffering up to capacity values onto stack
+	OpChsend = OpCode(202) // (), consume a value then a channel from top of stack, send the value, waiting while the channel is full
+	OpChrecv = OpCode(203) // (), consume a channel from top of stack, push the next value received, waiting while the channel is empty
+
+	OpMin  = OpCode(211) // (), consume top two ints of stack, push the smaller onto stack
+	OpMax  = OpCode(212) // (), consume top two ints of stack, push the larger onto stack
+	OpPow  = OpCode(213) // (), consume top two ints of stack, push (top-1) raised to the power (top) onto stack
+	OpSqrt = OpCode(214) // (), consume a float from top of stack, push its square root onto stack
+
+	OpBigpush     = OpCode(221) // (value:bigint), push arbitrary-precision value onto stack
+	OpBigadd      = OpCode(222) // (), consume top two ints or bigints of stack, push bigint sum onto stack
+	OpBigsubtract = OpCode(223) // (), consume top two ints or bigints of stack, push bigint (top-1) - (top) onto stack
+	OpBigmultiply = OpCode(224) // (), consume top two ints or bigints of stack, push bigint product onto stack
+	OpBigdivide   = OpCode(225) // (), consume top two ints or bigints of stack, push bigint (top-1) / (top) onto stack
+
+	OpNpush = OpCode(231) // (), push nil onto stack
+	OpJnil  = OpCode(232) // (line:int), consume top of stack, jump to line number if it is nil
+	OpJrel  = OpCode(233) // (offset:int), jump offset lines from the line of this instruction
+	OpJrell = OpCode(234) // (value:int, offset:int), if the consumed top of stack is less than value, jump offset lines from the line of this instruction
+
+	OpRnew = OpCode(241) // (), push a new record with no fields onto stack
+	OpRget = OpCode(242) // (field:string), consume a record from top of stack, push the value of its field onto stack
+	OpRset = OpCode(243) // (field:string), consume a value from top of stack, store it in the field of the record left on top of stack
+
+	OpBnew = OpCode(251) // (), consume a length from top of stack, push a new zeroed byte buffer of that length onto stack
+	OpBget = OpCode(252) // (), consume an index then a byte buffer from top of stack, push the byte at index onto stack
+	OpBset = OpCode(253) // (), consume a byte then an index from top of stack, store the byte at index of the buffer left on top of stack
+	OpBlen = OpCode(254) // (), consume a byte buffer from top of stack, push its length onto stack
+	OpBstr = OpCode(255) // (), consume a byte buffer from top of stack, push a string of its bytes onto stack
 )
 
 const (
@@ -23,40 +190,400 @@ const (
 	InstructionPut          = "put"
 	InstructionJump         = "jump"
 	InstructionJumpLessThan = "jumpl"
+	InstructionDedupStack   = "dedup"
+	InstructionShowInstr    = "showinstr"
+	InstructionHalt         = "halt"
+	InstructionNop          = "nop"
+	InstructionLoadc        = "loadc"
 
-	InstructionIpush     = "ipush"
-	InstructionIadd      = "iadd"
-	InstructionIsubtract = "isub"
+	InstructionIpush      = "ipush"
+	InstructionIadd       = "iadd"
+	InstructionImultiply  = "imul"
+	InstructionIsubtract  = "isub"
+	InstructionIdivide    = "idiv"
+	InstructionImodulo    = "imod"
+	InstructionInegate    = "ineg"
+	InstructionIabsolute  = "iabs"
+	InstructionIincrement = "iinc"
 
 	InstructionSpush = "spush"
 	InstructionSadd  = "sadd"
+	InstructionSsub  = "ssub"
+	InstructionSchar = "schar"
+	InstructionSlen  = "slen"
+	InstructionSblen = "sblen"
+	InstructionSeq   = "seq"
+	InstructionScmp  = "scmp"
+
+	InstructionFpush     = "fpush"
+	InstructionFadd      = "fadd"
+	InstructionFsubtract = "fsub"
+	InstructionFmultiply = "fmul"
+	InstructionFdivide   = "fdiv"
+
+	InstructionBand       = "band"
+	InstructionBor        = "bor"
+	InstructionBxor       = "bxor"
+	InstructionBnot       = "bnot"
+	InstructionShiftLeft  = "shl"
+	InstructionShiftRight = "shr"
+
+	InstructionIequal        = "ieq"
+	InstructionInotEqual     = "ine"
+	InstructionIlessThan     = "ilt"
+	InstructionIlessEqual    = "ile"
+	InstructionIgreaterThan  = "igt"
+	InstructionIgreaterEqual = "ige"
+
+	InstructionBpush = "bpush"
+	InstructionAnd   = "and"
+	InstructionOr    = "or"
+	InstructionNot   = "not"
+
+	InstructionJumpEqual        = "jeq"
+	InstructionJumpNotEqual     = "jne"
+	InstructionJumpGreaterThan  = "jgt"
+	InstructionJumpGreaterEqual = "jge"
+	InstructionJumpLessEqual    = "jle"
+	InstructionJumpZero         = "jz"
+	InstructionJumpNotZero      = "jnz"
+	InstructionJumpDynamic      = "jumpd"
+	InstructionJumpTable        = "jtable"
+
+	InstructionSwap  = "swap"
+	InstructionOver  = "over"
+	InstructionRot   = "rot"
+	InstructionDrop  = "drop"
+	InstructionPick  = "pick"
+	InstructionDepth = "depth"
+	InstructionClear = "clear"
+	InstructionDupn  = "dupn"
+
+	InstructionCall     = "call"
+	InstructionReturn   = "ret"
+	InstructionLoadl    = "loadl"
+	InstructionStorel   = "storel"
+	InstructionTailCall = "tcall"
+	InstructionCpush    = "cpush"
+	InstructionCalli    = "calli"
+	InstructionSpawn    = "spawn"
+	InstructionYield    = "yield"
+
+	InstructionGload  = "gload"
+	InstructionGstore = "gstore"
+	InstructionLoad   = "load"
+	InstructionStore  = "store"
+
+	InstructionAlloc  = "alloc"
+	InstructionFree   = "free"
+	InstructionRload  = "rload"
+	InstructionRstore = "rstore"
+	InstructionMload  = "mload"
+	InstructionMstore = "mstore"
+
+	InstructionAnew  = "anew"
+	InstructionAget  = "aget"
+	InstructionAset  = "aset"
+	InstructionAlen  = "alen"
+	InstructionApush = "apush"
+
+	InstructionMnew = "mnew"
+	InstructionMget = "mget"
+	InstructionMset = "mset"
+	InstructionMhas = "mhas"
+	InstructionMdel = "mdel"
+	InstructionMlen = "mlen"
+
+	InstructionSupper   = "supper"
+	InstructionSlower   = "slower"
+	InstructionStrim    = "strim"
+	InstructionSsplit   = "ssplit"
+	InstructionSjoin    = "sjoin"
+	InstructionSfind    = "sfind"
+	InstructionSreplace = "sreplace"
+	InstructionSfmt     = "sfmt"
+	InstructionSbytes   = "sbytes"
+
+	InstructionPutf     = "putf"
+	InstructionReadi    = "readi"
+	InstructionReads    = "reads"
+	InstructionReadline = "readline"
+	InstructionEput     = "eput"
+	InstructionEputln   = "eputln"
+
+	InstructionItos   = "itos"
+	InstructionStoi   = "stoi"
+	InstructionChr    = "chr"
+	InstructionOrd    = "ord"
+	InstructionTypeof = "typeof"
+
+	InstructionAssert = "assert"
+	InstructionBrk    = "brk"
+	InstructionBtrace = "btrace"
+
+	InstructionTry    = "try"
+	InstructionThrow  = "throw"
+	InstructionEndTry = "endtry"
+
+	InstructionRand     = "rand"
+	InstructionNow      = "now"
+	InstructionElapsed  = "elapsed"
+	InstructionSleep    = "sleep"
+	InstructionGetenv   = "getenv"
+	InstructionFread    = "fread"
+	InstructionFwrite   = "fwrite"
+	InstructionHostcall = "hostcall"
+	InstructionSys      = "sys"
+
+	InstructionChnew  = "chnew"
+	InstructionChsend = "chsend"
+	InstructionChrecv = "chrecv"
+
+	InstructionMin  = "min"
+	InstructionMax  = "max"
+	InstructionPow  = "pow"
+	InstructionSqrt = "sqrt"
+
+	InstructionBigpush     = "bigpush"
+	InstructionBigadd      = "bigadd"
+	InstructionBigsubtract = "bigsub"
+	InstructionBigmultiply = "bigmul"
+	InstructionBigdivide   = "bigdiv"
+
+	InstructionNpush = "npush"
+	InstructionJnil  = "jnil"
+	InstructionJrel  = "jrel"
+	InstructionJrell = "jrell"
+
+	InstructionRnew = "rnew"
+	InstructionRget = "rget"
+	InstructionRset = "rset"
+
+	InstructionBnew = "bnew"
+	InstructionBget = "bget"
+	InstructionBset = "bset"
+	InstructionBlen = "blen"
+	InstructionBstr = "bstr"
 )
 
+// ArgType is the type of an instruction's argument
 type ArgType int
 
+// The argument types of instruction signatures
 const (
-	argInt    ArgType = iota
-	argString
+	ArgInt ArgType = iota
+	ArgString
+	ArgFloat
+	ArgBool
+	ArgIntList // a count n followed by n ints or names of labels
+	ArgBigInt
+	ArgLine // a line number or the name of a label
 )
 
+// argTypeNames describe argument types in parse errors
+var argTypeNames = map[ArgType]string{
+	ArgInt:     "int",
+	ArgString:  "string",
+	ArgFloat:   "float",
+	ArgBool:    "bool",
+	ArgIntList: "int list",
+	ArgBigInt:  "bigint",
+	ArgLine:    "line number or label",
+}
+
+func (t ArgType) String() string {
+	if name, ok := argTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 type instructionSignature struct {
 	op   OpCode
 	args []ArgType
 }
 
 var (
-	instructionSignatures = map[string]instructionSignature{
+	// builtinSignatures are the instructions of the language before any are registered
+	builtinSignatures = map[string]instructionSignature{
 		InstructionPutln:        {OpPutln, nil},
 		InstructionDup:          {OpDup, nil},
 		InstructionPut:          {OpPut, nil},
-		InstructionJump:         {OpJump, []ArgType{argInt}},
-		InstructionJumpLessThan: {OpJumpLessThan, []ArgType{argInt, argInt}},
+		InstructionJump:         {OpJump, []ArgType{ArgLine}},
+		InstructionJumpLessThan: {OpJumpLessThan, []ArgType{ArgInt, ArgLine}},
+		InstructionDedupStack:   {OpDedupStack, nil},
+		InstructionShowInstr:    {OpShowInstr, []ArgType{ArgLine}},
+		InstructionHalt:         {OpHalt, []ArgType{ArgInt}},
+		InstructionNop:          {OpNop, nil},
+		InstructionLoadc:        {OpLoadc, []ArgType{ArgInt}},
 
-		InstructionIpush:     {OpIpush, []ArgType{argInt}},
-		InstructionIadd:      {OpIadd, nil},
-		InstructionIsubtract: {OpIsubtract, nil},
+		InstructionIpush:      {OpIpush, []ArgType{ArgInt}},
+		InstructionIadd:       {OpIadd, nil},
+		InstructionImultiply:  {OpImultiply, nil},
+		InstructionIsubtract:  {OpIsubtract, nil},
+		InstructionIdivide:    {OpIdivide, nil},
+		InstructionImodulo:    {OpImodulo, nil},
+		InstructionInegate:    {OpInegate, nil},
+		InstructionIabsolute:  {OpIabsolute, nil},
+		InstructionIincrement: {OpIincrement, []ArgType{ArgInt}},
 
-		InstructionSpush: {OpSpush, []ArgType{argString}},
+		InstructionSpush: {OpSpush, []ArgType{ArgString}},
 		InstructionSadd:  {OpSadd, nil},
+		InstructionSsub:  {OpSsub, nil},
+		InstructionSchar: {OpSchar, nil},
+		InstructionSlen:  {OpSlen, nil},
+		InstructionSblen: {OpSblen, nil},
+		InstructionSeq:   {OpSeq, nil},
+		InstructionScmp:  {OpScmp, nil},
+
+		InstructionFpush:     {OpFpush, []ArgType{ArgFloat}},
+		InstructionFadd:      {OpFadd, nil},
+		InstructionFsubtract: {OpFsubtract, nil},
+		InstructionFmultiply: {OpFmultiply, nil},
+		InstructionFdivide:   {OpFdivide, nil},
+
+		InstructionBand:       {OpBand, nil},
+		InstructionBor:        {OpBor, nil},
+		InstructionBxor:       {OpBxor, nil},
+		InstructionBnot:       {OpBnot, nil},
+		InstructionShiftLeft:  {OpShiftLeft, nil},
+		InstructionShiftRight: {OpShiftRight, nil},
+
+		InstructionIequal:        {OpIequal, nil},
+		InstructionInotEqual:     {OpInotEqual, nil},
+		InstructionIlessThan:     {OpIlessThan, nil},
+		InstructionIlessEqual:    {OpIlessEqual, nil},
+		InstructionIgreaterThan:  {OpIgreaterThan, nil},
+		InstructionIgreaterEqual: {OpIgreaterEqual, nil},
+
+		InstructionBpush: {OpBpush, []ArgType{ArgBool}},
+		InstructionAnd:   {OpAnd, nil},
+		InstructionOr:    {OpOr, nil},
+		InstructionNot:   {OpNot, nil},
+
+		InstructionJumpEqual:        {OpJumpEqual, []ArgType{ArgInt, ArgLine}},
+		InstructionJumpNotEqual:     {OpJumpNotEqual, []ArgType{ArgInt, ArgLine}},
+		InstructionJumpGreaterThan:  {OpJumpGreaterThan, []ArgType{ArgInt, ArgLine}},
+		InstructionJumpGreaterEqual: {OpJumpGreaterEqual, []ArgType{ArgInt, ArgLine}},
+		InstructionJumpLessEqual:    {OpJumpLessEqual, []ArgType{ArgInt, ArgLine}},
+		InstructionJumpZero:         {OpJumpZero, []ArgType{ArgLine}},
+		InstructionJumpNotZero:      {OpJumpNotZero, []ArgType{ArgLine}},
+		InstructionJumpDynamic:      {OpJumpDynamic, nil},
+		InstructionJumpTable:        {OpJumpTable, []ArgType{ArgIntList, ArgLine}},
+
+		InstructionSwap:  {OpSwap, nil},
+		InstructionOver:  {OpOver, nil},
+		InstructionRot:   {OpRot, nil},
+		InstructionDrop:  {OpDrop, nil},
+		InstructionPick:  {OpPick, []ArgType{ArgInt}},
+		InstructionDepth: {OpDepth, nil},
+		InstructionClear: {OpClear, nil},
+		InstructionDupn:  {OpDupn, []ArgType{ArgInt}},
+
+		InstructionCall:     {OpCall, []ArgType{ArgLine}},
+		InstructionReturn:   {OpReturn, nil},
+		InstructionLoadl:    {OpLoadl, []ArgType{ArgInt}},
+		InstructionStorel:   {OpStorel, []ArgType{ArgInt}},
+		InstructionTailCall: {OpTailCall, []ArgType{ArgLine}},
+		InstructionCpush:    {OpCpush, []ArgType{ArgLine}},
+		InstructionCalli:    {OpCalli, nil},
+		InstructionSpawn:    {OpSpawn, []ArgType{ArgLine}},
+		InstructionYield:    {OpYield, nil},
+
+		InstructionGload:  {OpGload, []ArgType{ArgInt}},
+		InstructionGstore: {OpGstore, []ArgType{ArgInt}},
+		InstructionLoad:   {OpLoad, []ArgType{ArgString}},
+		InstructionStore:  {OpStore, []ArgType{ArgString}},
+
+		InstructionAlloc:  {OpAlloc, nil},
+		InstructionFree:   {OpFree, nil},
+		InstructionRload:  {OpRload, nil},
+		InstructionRstore: {OpRstore, nil},
+		InstructionMload:  {OpMload, []ArgType{ArgInt}},
+		InstructionMstore: {OpMstore, []ArgType{ArgInt}},
+
+		InstructionAnew:  {OpAnew, nil},
+		InstructionAget:  {OpAget, nil},
+		InstructionAset:  {OpAset, nil},
+		InstructionAlen:  {OpAlen, nil},
+		InstructionApush: {OpApush, nil},
+
+		InstructionMnew: {OpMnew, nil},
+		InstructionMget: {OpMget, nil},
+		InstructionMset: {OpMset, nil},
+		InstructionMhas: {OpMhas, nil},
+		InstructionMdel: {OpMdel, nil},
+		InstructionMlen: {OpMlen, nil},
+
+		InstructionSupper:   {OpSupper, nil},
+		InstructionSlower:   {OpSlower, nil},
+		InstructionStrim:    {OpStrim, nil},
+		InstructionSsplit:   {OpSsplit, nil},
+		InstructionSjoin:    {OpSjoin, nil},
+		InstructionSfind:    {OpSfind, nil},
+		InstructionSreplace: {OpSreplace, nil},
+		InstructionSfmt:     {OpSfmt, []ArgType{ArgString}},
+		InstructionSbytes:   {OpSbytes, nil},
+
+		InstructionPutf:     {OpPutf, []ArgType{ArgString}},
+		InstructionReadi:    {OpReadi, nil},
+		InstructionReads:    {OpReads, nil},
+		InstructionReadline: {OpReadline, nil},
+		InstructionEput:     {OpEput, nil},
+		InstructionEputln:   {OpEputln, nil},
+
+		InstructionItos:   {OpItos, nil},
+		InstructionStoi:   {OpStoi, nil},
+		InstructionChr:    {OpChr, nil},
+		InstructionOrd:    {OpOrd, nil},
+		InstructionTypeof: {OpTypeof, nil},
+
+		InstructionAssert: {OpAssert, []ArgType{ArgString}},
+		InstructionBrk:    {OpBrk, nil},
+		InstructionBtrace: {OpBtrace, nil},
+
+		InstructionTry:    {OpTry, []ArgType{ArgLine}},
+		InstructionThrow:  {OpThrow, nil},
+		InstructionEndTry: {OpEndTry, nil},
+
+		InstructionRand:     {OpRand, nil},
+		InstructionNow:      {OpNow, nil},
+		InstructionElapsed:  {OpElapsed, nil},
+		InstructionSleep:    {OpSleep, []ArgType{ArgInt}},
+		InstructionGetenv:   {OpGetenv, []ArgType{ArgString}},
+		InstructionFread:    {OpFread, nil},
+		InstructionFwrite:   {OpFwrite, nil},
+		InstructionHostcall: {OpHostcall, []ArgType{ArgString, ArgInt}},
+		InstructionSys:      {OpSys, []ArgType{ArgInt}},
+
+		InstructionChnew:  {OpChnew, []ArgType{ArgInt}},
+		InstructionChsend: {OpChsend, nil},
+		InstructionChrecv: {OpChrecv, nil},
+
+		InstructionMin:  {OpMin, nil},
+		InstructionMax:  {OpMax, nil},
+		InstructionPow:  {OpPow, nil},
+		InstructionSqrt: {OpSqrt, nil},
+
+		InstructionBigpush:     {OpBigpush, []ArgType{ArgBigInt}},
+		InstructionBigadd:      {OpBigadd, nil},
+		InstructionBigsubtract: {OpBigsubtract, nil},
+		InstructionBigmultiply: {OpBigmultiply, nil},
+		InstructionBigdivide:   {OpBigdivide, nil},
+
+		InstructionNpush: {OpNpush, nil},
+		InstructionJnil:  {OpJnil, []ArgType{ArgLine}},
+		InstructionJrel:  {OpJrel, []ArgType{ArgInt}},
+		InstructionJrell: {OpJrell, []ArgType{ArgInt, ArgInt}},
+
+		InstructionRnew: {OpRnew, nil},
+		InstructionRget: {OpRget, []ArgType{ArgString}},
+		InstructionRset: {OpRset, []ArgType{ArgString}},
+
+		InstructionBnew: {OpBnew, nil},
+		InstructionBget: {OpBget, nil},
+		InstructionBset: {OpBset, nil},
+		InstructionBlen: {OpBlen, nil},
+		InstructionBstr: {OpBstr, nil},
 	}
 )
@@ -0,0 +1,455 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Pass is a transform of programs, run by a Pipeline
+type Pass interface {
+	// Name identifies the pass in a Pipeline's results and errors
+	Name() string
+
+	// Run returns a program equivalent to the one given, without modifying it
+	Run(*Program) (*Program, error)
+}
+
+// PassFunc returns a Pass with the given name that runs run
+func PassFunc(name string, run func(*Program) (*Program, error)) Pass {
+	return funcPass{name: name, run: run}
+}
+
+type funcPass struct {
+	name string
+	run  func(*Program) (*Program, error)
+}
+
+func (f funcPass) Name() string {
+	return f.name
+}
+
+func (f funcPass) Run(program *Program) (*Program, error) {
+	return f.run(program)
+}
+
+// The built in passes
+var (
+	FoldConstantsPass     = PassFunc("fold-constants", FoldConstants)
+	PeepholePass          = PassFunc("peephole", Peephole)
+	EliminateDeadCodePass = PassFunc("eliminate-dead-code", EliminateDeadCode)
+)
+
+// DefaultPasses are the passes Optimize runs when it is given none. Peephole
+// runs again once dead code is gone, because jumps over it go to the next instruction.
+var DefaultPasses = []Pass{FoldConstantsPass, PeepholePass, EliminateDeadCodePass, PeepholePass}
+
+// Optimize returns the program transformed by each of the passes in order,
+// or by DefaultPasses if none are given. The program is not modified.
+func Optimize(program *Program, passes ...Pass) (*Program, error) {
+	if len(passes) == 0 {
+		passes = DefaultPasses
+	}
+	optimized, _, err := NewPipeline(passes...).Run(program)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to optimize program")
+	}
+	return optimized, nil
+}
+
+// foldBinary computes the int operations FoldConstants folds, false if the
+// result depends on how the program is run, because it overflows or fails
+var foldBinary = map[OpCode]func(b, a int) (int, bool){
+	OpIadd:      func(b, a int) (int, bool) { return b + a, !addOverflows(b, a) },
+	OpIsubtract: func(b, a int) (int, bool) { return b - a, !subOverflows(b, a) },
+	OpImultiply: func(b, a int) (int, bool) { return b * a, !mulOverflows(b, a) },
+	OpIdivide: func(b, a int) (int, bool) {
+		if a == 0 || divOverflows(b, a) {
+			return 0, false
+		}
+		return b / a, true
+	},
+	OpImodulo: func(b, a int) (int, bool) {
+		if a == 0 {
+			return 0, false
+		}
+		return b % a, true
+	},
+	OpBand: func(b, a int) (int, bool) { return b & a, true },
+	OpBor:  func(b, a int) (int, bool) { return b | a, true },
+	OpBxor: func(b, a int) (int, bool) { return b ^ a, true },
+}
+
+// foldUnary computes the int operations on a single value FoldConstants folds
+var foldUnary = map[OpCode]func(a int) (int, bool){
+	OpInegate: func(a int) (int, bool) { return -a, !negOverflows(a) },
+	OpIabsolute: func(a int) (int, bool) {
+		if a < 0 {
+			return -a, !negOverflows(a)
+		}
+		return a, true
+	},
+	OpBnot: func(a int) (int, bool) { return ^a, true },
+}
+
+// FoldConstants replaces int arithmetic on values pushed by ipush with a
+// single ipush of the result, so that "ipush 2; ipush 3; iadd" becomes
+// "ipush 5". Operations are folded until no more can be, and only when none of
+// the folded instructions but the first is jumped to. Operations that overflow
+// or divide by zero are kept to fail or wrap when they are run.
+func FoldConstants(program *Program) (*Program, error) {
+	for {
+		edits, err := program.peephole(func(w window) bool {
+			first, ok := w.ipush(0)
+			if !ok || !w.joined(1) {
+				return false
+			}
+			if fold, ok := foldUnary[w.op(1)]; ok {
+				if c, ok := fold(first); ok {
+					w.replace(0, OpIpush, c)
+					w.remove(1)
+					return true
+				}
+				return false
+			}
+			second, ok := w.ipush(1)
+			if !ok || !w.joined(2) {
+				return false
+			}
+			if fold, ok := foldBinary[w.op(2)]; ok {
+				if c, ok := fold(first, second); ok {
+					w.replace(0, OpIpush, c)
+					w.remove(1)
+					w.remove(2)
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to fold constants")
+		}
+		if len(edits) == 0 {
+			return program.copy(), nil
+		}
+		program = program.rewrite(edits)
+	}
+}
+
+// pushes are the instructions that only push a value, which Peephole removes along with a drop that follows them
+var pushes = map[OpCode]bool{
+	OpIpush:   true,
+	OpSpush:   true,
+	OpFpush:   true,
+	OpBpush:   true,
+	OpBigpush: true,
+	OpNpush:   true,
+	OpCpush:   true,
+}
+
+// Peephole makes local improvements to the program's instructions: jumps to a
+// line that starts with a jump go to that jump's line instead, repeatedly,
+// jumps to the next instruction are removed, and a value pushed and then dropped
+// is never pushed. A drop is only removed with its push when it is not jumped to.
+func Peephole(program *Program) (*Program, error) {
+	edits, err := program.peephole(func(w window) bool {
+		op := w.op(0)
+		if pushes[op] && w.joined(1) && w.op(1) == OpDrop {
+			w.remove(0)
+			w.remove(1)
+			return true
+		}
+		if !jumpOps[op] {
+			return false
+		}
+		instruction := w.instruction(0)
+		retargeted := false
+		for index, arg := range instruction[1:] {
+			switch arg := arg.(type) {
+			case int:
+				if instructionSignatures()[opMnemonics()[op]].args[index] != ArgLine {
+					continue
+				}
+				if line, ok := program.jumpChain(arg); ok {
+					instruction[1+index] = line
+					retargeted = true
+				}
+			case []int:
+				lines := append([]int{}, arg...)
+				for position, line := range lines {
+					if target, ok := program.jumpChain(line); ok {
+						lines[position] = target
+						retargeted = true
+					}
+				}
+				instruction[1+index] = lines
+			}
+		}
+		if op == OpJump {
+			if ip, ok := program.lineStart(instruction[1].(int)); ok && ip == w.ips[0]+2 {
+				// the jump goes where control would continue anyway
+				w.remove(0)
+				return true
+			}
+		}
+		if retargeted {
+			w.replace(0, instruction...)
+		}
+		return retargeted
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to apply peephole optimizations")
+	}
+	return program.rewrite(edits), nil
+}
+
+// jumpOps are the instructions whose line arguments Peephole retargets.
+// Calls are not retargeted, because they name the procedure they call.
+var jumpOps = map[OpCode]bool{
+	OpJump:             true,
+	OpJumpLessThan:     true,
+	OpJumpEqual:        true,
+	OpJumpNotEqual:     true,
+	OpJumpGreaterThan:  true,
+	OpJumpGreaterEqual: true,
+	OpJumpLessEqual:    true,
+	OpJumpZero:         true,
+	OpJumpNotZero:      true,
+	OpJumpTable:        true,
+	OpJnil:             true,
+	OpTry:              true,
+}
+
+// jumpChain returns the line that a jump to line ends up at by following the
+// jumps that lines start with, false if line does not start with a jump or
+// the jumps loop forever
+func (p *Program) jumpChain(line int) (int, bool) {
+	seen := map[int]bool{line: true}
+	target := line
+	for {
+		ip, ok := p.lineStart(target)
+		if !ok || ip >= len(p.instructions) || p.instructions[ip] != OpJump {
+			break
+		}
+		next := p.instructions[ip+1].(int)
+		if seen[next] {
+			return 0, false
+		}
+		seen[next] = true
+		target = next
+	}
+	return target, target != line
+}
+
+// window is the instructions following a position in the program that
+// peephole offers to a rule, and the edits the rule makes to them
+type window struct {
+	program *Program
+
+	// ips are the positions of the instructions in the window, in order
+	ips []int
+
+	// entries are the positions control can move to other than from the instruction before
+	entries map[int]bool
+
+	edits map[int][]interface{}
+}
+
+// op returns the op code of the nth instruction of the window, which
+// must be in the window, as joined and ipush check
+func (w window) op(n int) OpCode {
+	return w.program.instructions[w.ips[n]].(OpCode)
+}
+
+// instruction returns a copy of the nth instruction of the window, its op code followed by its arguments
+func (w window) instruction(n int) []interface{} {
+	ip := w.ips[n]
+	op := w.program.instructions[ip].(OpCode)
+	return append([]interface{}{}, w.program.instructions[ip:ip+1+len(instructionSignatures()[opMnemonics()[op]].args)]...)
+}
+
+// ipush returns the value pushed by the nth instruction of the window if it is an ipush
+func (w window) ipush(n int) (int, bool) {
+	if n >= len(w.ips) || w.op(n) != OpIpush {
+		return 0, false
+	}
+	return w.program.instructions[w.ips[n]+1].(int), true
+}
+
+// joined reports whether the instructions of the window up to the nth can only
+// run one after the other, because no instruction jumps to any but the first
+func (w window) joined(n int) bool {
+	if n >= len(w.ips) {
+		return false
+	}
+	for _, ip := range w.ips[1 : n+1] {
+		if w.entries[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+// replace replaces the nth instruction of the window with instruction
+func (w window) replace(n int, instruction ...interface{}) {
+	w.edits[w.ips[n]] = instruction
+}
+
+// remove removes the nth instruction of the window
+func (w window) remove(n int) {
+	w.edits[w.ips[n]] = nil
+}
+
+// peepholeWindow is the number of instructions offered to peephole rules
+const peepholeWindow = 3
+
+// peephole offers the instructions from each position in the program to
+// rule, which edits them and reports whether it did. Instructions a rule
+// edits are not offered to rules again. It returns the edits made, which
+// rewrite applies.
+func (p *Program) peephole(rule func(w window) bool) (map[int][]interface{}, error) {
+	cfg, err := AnalyzeCFG(p)
+	if err != nil {
+		return nil, err
+	}
+	entries := p.entries(cfg)
+	var starts []int
+	p.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		starts = append(starts, ip)
+		return nil
+	})
+	edits := make(map[int][]interface{})
+	for index := 0; index < len(starts); index++ {
+		w := window{program: p, ips: starts[index:smaller(index+peepholeWindow, len(starts))], entries: entries, edits: edits}
+		if !rule(w) {
+			continue
+		}
+		// skip the instructions the rule edited
+		for index+1 < len(starts) {
+			if _, ok := edits[starts[index+1]]; !ok {
+				break
+			}
+			index++
+		}
+	}
+	return edits, nil
+}
+
+// entries returns the instruction positions control can move to other than
+// from the instruction before: the starts of basic blocks, of exported lines,
+// or of every line if the program jumps to lines computed at runtime
+func (p *Program) entries(cfg *CFG) map[int]bool {
+	entries := make(map[int]bool)
+	for _, block := range cfg.Blocks {
+		entries[block.Start] = true
+	}
+	for _, symbol := range p.symbols {
+		if ip, ok := p.lineStart(symbol.Line); ok && !symbol.Extern {
+			entries[ip] = true
+		}
+	}
+	if p.liveBlocks(cfg) == nil {
+		for _, ip := range p.jumpTable {
+			entries[ip] = true
+		}
+	}
+	return entries
+}
+
+// rewrite returns a copy of the program with the instructions at the
+// positions in edits replaced by the instruction they map to, an op code
+// followed by its arguments, or removed if it is nil. Line numbers are kept,
+// and lines starting at a removed instruction start at the next instruction
+// that is kept. Replaced instructions keep the source position of the
+// instruction they replace.
+func (p *Program) rewrite(edits map[int][]interface{}) *Program {
+	if len(edits) == 0 {
+		return p.copy()
+	}
+	out := &Program{
+		constants: append([]interface{}{}, p.constants...),
+		symbols:   append([]Symbol{}, p.symbols...),
+		entry:     p.entry,
+		labels:    append([]labelDefinition{}, p.labels...),
+	}
+
+	// relocated maps every instruction position, and the end of the program,
+	// to its position in the rewritten program. Removed instructions move to
+	// the position of the next instruction that is kept.
+	relocated := make([]int, len(p.instructions)+1)
+	keptAt := make(map[int]bool)
+	op := 0
+	p.decode(func(ip int, code OpCode, signature instructionSignature) error {
+		relocated[ip] = len(out.instructions)
+		instruction, edited := edits[ip]
+		if !edited {
+			instruction = p.instructions[ip : ip+1+len(signature.args)]
+		}
+		if instruction != nil {
+			keptAt[ip] = true
+			out.instructions = append(out.instructions, instruction...)
+			if op < len(p.ast) {
+				node := p.ast[op]
+				if edited {
+					node = editedNode(node, p.instructions[ip:ip+1+len(signature.args)], instruction)
+				}
+				out.ast = append(out.ast, node)
+			}
+		}
+		op++
+		return nil
+	})
+	relocated[len(p.instructions)] = len(out.instructions)
+
+	out.jumpTable = make([]int, len(p.jumpTable))
+	for index, ip := range p.jumpTable {
+		out.jumpTable[index] = relocated[ip]
+	}
+	for index, mark := range p.marks {
+		mark.ip = relocated[mark.ip]
+		// of the marks moved to the same instruction, the last one declares its source
+		if index+1 < len(p.marks) && relocated[p.marks[index+1].ip] == mark.ip {
+			continue
+		}
+		out.marks = append(out.marks, mark)
+	}
+	for _, position := range p.sourceMap {
+		if keptAt[position.ip] {
+			position.ip = relocated[position.ip]
+			out.sourceMap = append(out.sourceMap, position)
+		}
+	}
+	return out
+}
+
+// editedNode returns the AST node of instruction, which replaced the original
+// instruction parsed as node. Arguments it shares with the original are kept
+// as they were written.
+func editedNode(node Instruction, original, instruction []interface{}) Instruction {
+	edited := Instruction{OpCode: instruction[0].(OpCode), Position: node.Position}
+	for index, arg := range instruction[1:] {
+		if edited.OpCode == node.OpCode && index < len(node.Args) && sameArg(original[1+index], arg) {
+			arg = node.Args[index]
+		}
+		edited.Args = append(edited.Args, arg)
+	}
+	return edited
+}
+
+// sameArg reports whether two instruction arguments have the same value
+func sameArg(a, b interface{}) bool {
+	if list, ok := a.([]int); ok {
+		other, ok := b.([]int)
+		if !ok || len(list) != len(other) {
+			return false
+		}
+		for index := range list {
+			if list[index] != other[index] {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := b.([]int); ok {
+		return false
+	}
+	return a == b
+}
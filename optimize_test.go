@@ -0,0 +1,105 @@
+package crust
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOptimizeKeepsBehavior(t *testing.T) {
+	tests := map[string]struct {
+		src    string
+		shrink bool
+	}{
+		"fold": {
+			src:    "ipush 2\nipush 3\niadd\nipush 4\nimul\nineg\nput",
+			shrink: true,
+		},
+		"push and drop before a loop": {
+			src: `
+				spush unused
+				drop
+				fpush 1.5
+				drop
+				ipush 0
+			loop:	iinc 1
+				dup
+				put
+				dup
+				jumpl 5 loop
+			`,
+			shrink: true,
+		},
+		"jump chain": {
+			src: `
+				ipush 0
+				jump first
+			first:	jump second
+				spush skipped
+				put
+			second:	ipush 7
+				put
+			`,
+			shrink: true,
+		},
+		"dead code before jump table targets": {
+			src: `
+				ipush 1
+				jtable 2 one two two
+				spush dead
+				put
+			one:	spush one
+				put
+				halt 0
+			two:	spush two
+				put
+			`,
+			shrink: true,
+		},
+		"folded loop bound": {
+			src: `
+				ipush 0
+			loop:	iinc 1
+				ipush 2
+				ipush 3
+				imul
+				drop
+				dup
+				put
+				dup
+				jumpl 3 loop
+			`,
+			shrink: true,
+		},
+		"division by zero is kept": {
+			src: "spush a\nput\nipush 1\nipush 0\nidiv\nput",
+		},
+		"overflow is kept": {
+			src: "ipush 9223372036854775807\nipush 1\niadd\nput",
+		},
+	}
+	for name, test := range tests {
+		program, err := NewProgramFromReader(strings.NewReader(test.src))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		optimized, err := Optimize(program)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := Verify(optimized); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if test.shrink && optimized.opCount() >= program.opCount() {
+			t.Fatalf("%s: expected fewer than %d instructions, got %d", name, program.opCount(), optimized.opCount())
+		}
+		for _, checked := range []bool{false, true} {
+			var want, got bytes.Buffer
+			wantErr := NewInterpreter(program, WithStdout(&want), WithCheckedArithmetic(checked)).Run()
+			gotErr := NewInterpreter(optimized, WithStdout(&got), WithCheckedArithmetic(checked)).Run()
+			if got.String() != want.String() || (gotErr == nil) != (wantErr == nil) {
+				t.Fatalf("%s: expected %q, %v, got %q, %v", name, want.String(), wantErr, got.String(), gotErr)
+			}
+		}
+	}
+}
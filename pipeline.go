@@ -0,0 +1,66 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Pipeline runs passes over a program one after another
+type Pipeline struct {
+	passes []Pass
+}
+
+// PassResult is how a pass of a Pipeline changed the program,
+// by the number of instructions before and after it ran
+type PassResult struct {
+	Name   string
+	Before int
+	After  int
+}
+
+// NewPipeline returns a Pipeline that runs the passes in order
+func NewPipeline(passes ...Pass) *Pipeline {
+	return &Pipeline{passes: append([]Pass{}, passes...)}
+}
+
+// Passes returns the passes the pipeline runs, in order
+func (pl *Pipeline) Passes() []Pass {
+	return append([]Pass{}, pl.passes...)
+}
+
+// Run returns the program transformed by each pass in turn, with a result for
+// each pass. The program is not modified. The program each pass returns is
+// checked with Verify, so a pass that breaks the program is named by the error.
+func (pl *Pipeline) Run(program *Program) (*Program, []PassResult, error) {
+	if err := Verify(program); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to run pipeline")
+	}
+	current := program.copy()
+	results := make([]PassResult, 0, len(pl.passes))
+	for _, pass := range pl.passes {
+		result := PassResult{Name: pass.Name(), Before: current.opCount()}
+		next, err := pass.Run(current)
+		if err != nil {
+			return nil, results, errors.Wrapf(err, "pass %s failed", pass.Name())
+		}
+		if next == nil {
+			return nil, results, errors.Errorf("pass %s returned no program", pass.Name())
+		}
+		if err := Verify(next); err != nil {
+			return nil, results, errors.Wrapf(err, "pass %s returned an invalid program", pass.Name())
+		}
+		result.After = next.opCount()
+		results = append(results, result)
+		current = next
+	}
+	return current, results, nil
+}
+
+// opCount returns the number of instructions in the program, not counting their arguments
+func (p *Program) opCount() int {
+	count := 0
+	p.decode(func(int, OpCode, instructionSignature) error {
+		count++
+		return nil
+	})
+	return count
+}
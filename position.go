@@ -0,0 +1,53 @@
+package crust
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Position is a location in the source of a program
+type Position struct {
+	// File is the path of the source file, empty if the program was not read from a file
+	File string
+
+	// Line and Column are 1-based, counting columns in characters
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// ParseError describes a problem found while parsing a program
+type ParseError struct {
+	// Position is where the offending token starts
+	Position Position
+
+	// Token is the offending token, empty at the end of the program
+	Token string
+
+	// Expected describes what should have been found instead of Token,
+	// empty if the token is in the right place but is otherwise invalid
+	Expected string
+
+	// Err is the underlying problem, nil if it is fully described by Expected
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("%v: %v", e.Position, e.Err)
+	}
+	found := "end of program"
+	if e.Token != "" {
+		found = strconv.Quote(e.Token)
+	}
+	if e.Err == nil {
+		return fmt.Sprintf("%v: expected %s, found %s", e.Position, e.Expected, found)
+	}
+	return fmt.Sprintf("%v: expected %s, found %s: %v", e.Position, e.Expected, found, e.Err)
+}
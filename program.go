@@ -4,8 +4,14 @@ import (
 	"os"
 	"github.com/pkg/errors"
 	"io"
-	"bufio"
 	"strconv"
+	"sort"
+	"math/big"
+	"strings"
+	"unicode"
+	"path/filepath"
+	"io/ioutil"
+	"bytes"
 )
 
 // Program is a parsed crust program
@@ -18,63 +24,738 @@ type Program struct {
 	// their op code position in instructions. The jumpTable is 0-based whereas
 	// real line numbers are 1-based
 	jumpTable []int
+
+	// marks map instruction positions back to the source that
+	// generated them, ordered by instruction position
+	marks []sourceMark
+
+	// constants is the constant pool declared by .data sections
+	constants []interface{}
+
+	// symbols are the labels declared by .export and .extern directives
+	symbols []Symbol
+
+	// entry is the 1-based line number declared by .start, 0 to start at the first instruction
+	entry int
+
+	// ast are the instructions as they were parsed, one per op code in instructions
+	ast []Instruction
+
+	// sourceMap maps instruction positions to where they were written,
+	// ordered by instruction position
+	sourceMap []sourcePosition
+
+	// labels are the labels defined in the program's source, in the order they were defined
+	labels []labelDefinition
+}
+
+// ProgramOption configures how a program is parsed
+type ProgramOption func(*parser)
+
+// WithDefines defines symbols for .ifdef and .ifndef directives to test
+func WithDefines(names ...string) ProgramOption {
+	return func(p *parser) {
+		for _, name := range names {
+			p.defines[name] = true
+		}
+	}
+}
+
+// WithStrictLines makes a program line-oriented: each line may hold at most one
+// instruction, with its arguments on the same line, and line numbers given as
+// jump targets are the program's source lines. Lines without an instruction,
+// such as blank lines and comments, continue at the next instruction.
+func WithStrictLines(strict bool) ProgramOption {
+	return func(p *parser) {
+		p.strict = strict
+	}
+}
+
+// WithIncludePath adds directories to search for files named by .include
+// directives that are not found relative to the file including them
+func WithIncludePath(dirs ...string) ProgramOption {
+	return func(p *parser) {
+		p.includePath = append(p.includePath, dirs...)
+	}
 }
 
 // NewProgramFromFile reads a program from disk and creates the program for it
-func NewProgramFromFile(path string) (*Program, error) {
+func NewProgramFromFile(path string, opts ...ProgramOption) (*Program, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to open program file")
 	}
 	defer f.Close()
-	return NewProgramFromReader(f)
+	program, err := parseProgram(f, path, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse r")
+	}
+	return program, nil
 }
 
-// NewProgramFromReader reads a program from a reader and creates the program for it
-func NewProgramFromReader(r io.Reader) (*Program, error) {
-	instructions, jumpTable, err := parseProgram(r)
+// NewProgramFromReader reads a program from a reader and creates the program for it.
+// Files it includes are resolved relative to the working directory.
+func NewProgramFromReader(r io.Reader, opts ...ProgramOption) (*Program, error) {
+	program, err := parseProgram(r, "", opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to parse r")
 	}
-	program := &Program{
-		instructions: instructions,
-		jumpTable:    jumpTable,
-	}
 	return program, nil
 }
 
-func parseProgram(program io.Reader) (instructions []interface{}, jumpTable []int, err error) {
-	in := bufio.NewScanner(program)
-	in.Split(bufio.ScanWords)
+// lineOf returns the 1-based line number of the instruction
+// that the instruction index ip belongs to
+func (p *Program) lineOf(ip int) int {
+	return sort.Search(len(p.jumpTable), func(index int) bool {
+		return p.jumpTable[index] > ip
+	})
+}
+
+// eachArgument calls fn with the instruction index and type of every
+// argument of every instruction in the program
+func (p *Program) eachArgument(fn func(op OpCode, index int, argType ArgType)) {
+	for ip := 0; ip < len(p.instructions); {
+		op := p.instructions[ip].(OpCode)
+		signature := instructionSignatures()[opMnemonics()[op]]
+		for offset, argType := range signature.args {
+			fn(op, ip+1+offset, argType)
+		}
+		ip += 1 + len(signature.args)
+	}
+}
+
+// parser reads a program's tokens, keeping the symbols defined by its directives
+type parser struct {
+	*lexer
+
+	// consts maps the names defined by .const directives to their values
+	consts map[string]string
+
+	// macros maps the names defined by .macro directives to their definitions
+	macros map[string]*macro
+
+	// expansions counts macro expansions to stop runaway recursive macros
+	expansions int
+
+	// file is the path of the file being read, empty if it is not read from a file
+	file string
+
+	// includes are the files being read when the current file was included, innermost last
+	includes []include
+
+	// includePath are the directories searched for included files
+	includePath []string
+
+	// labels maps label names to the 1-based line numbers they refer to
+	labels map[string]int
+
+	// proc is the procedure being defined, nil outside of .proc and .endproc
+	proc *proc
+
+	// defines are the symbols tested by .ifdef and .ifndef directives
+	defines map[string]bool
+
+	// exports and externs are the labels named by .export and .extern directives
+	exports []token
+	externs []token
+
+	// start is the line number or label reference named by .start, nil without one,
+	// and startPos is where it was named
+	start    interface{}
+	startPos Position
+
+	// conditionals is the number of .ifdef and .ifndef directives awaiting their .endif
+	conditionals int
+
+	// strict enables line-oriented parsing, see WithStrictLines
+	strict bool
+
+	// mainLine is the line of the program's own source being parsed,
+	// which code from includes and macros is attributed to
+	mainLine int
+
+	// lastOp is the position of the most recent instruction read from the source
+	lastOp Position
+}
+
+// proc is a procedure defined by a .proc directive
+type proc struct {
+	name string
+
+	// start is the number of lines in the program before the procedure
+	start int
+}
+
+// procTerminators are the ops a procedure may end with, as they never
+// continue to the instruction following them
+var procTerminators = map[OpCode]bool{
+	OpReturn:      true,
+	OpJump:        true,
+	OpJumpDynamic: true,
+	OpJumpTable:   true,
+	OpJrel:        true,
+	OpTailCall:    true,
+	OpHalt:        true,
+	OpThrow:       true,
+}
+
+// include is a file whose reading was suspended by an .include directive
+type include struct {
+	lexer *lexer
+	file  string
+}
+
+// macro is an instruction sequence defined by a .macro directive
+type macro struct {
+	params []string
+	body   []token
+}
+
+// maxMacroExpansions limits the number of macro expansions in a program
+const maxMacroExpansions = 1 << 16
+
+func parseProgram(r io.Reader, file string, opts []ProgramOption) (*Program, error) {
+	unit, err := parseUnit(r, file, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveLabels(unit.program, unit.labels); err != nil {
+		return nil, err
+	}
+	return unit.program, nil
+}
+
+// parseUnit parses a program, leaving its label references unresolved
+func parseUnit(r io.Reader, file string, opts []ProgramOption) (*Unit, error) {
+	in := &parser{
+		lexer:   newLexer(r, file),
+		consts:  make(map[string]string),
+		macros:  make(map[string]*macro),
+		file:    file,
+		labels:  make(map[string]int),
+		defines: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
 
-	instructions = make([]interface{}, 0, 64)
-	jumpTable = make([]int, 0)
+	program := &Program{
+		instructions: make([]interface{}, 0, 64),
+		jumpTable:    make([]int, 0),
+	}
 	currentInstructions := new([16]interface{})
 
 	for in.Scan() {
 		if err := in.Err(); err != nil {
-			return nil, nil, errors.Wrap(err, "unable to scan program")
+			return nil, errors.Wrap(err, "unable to scan program")
 		}
 		token := in.Text()
+		if err := checkLineEnded(in); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(token, ".") {
+			if err := parseDirective(token, in, program); err != nil {
+				return nil, errors.Wrap(in.errorAt(err), "unable to parse directive")
+			}
+			continue
+		}
+		if strings.HasSuffix(token, ":") {
+			if err := in.defineLabel(program, strings.TrimSuffix(token, ":")); err != nil {
+				return nil, in.errorAt(err)
+			}
+			continue
+		}
+		if m, ok := in.macros[token]; ok && !in.Quoted() {
+			in.markOp()
+			if err := expandMacro(in, token, m); err != nil {
+				return nil, errors.Wrap(in.errorAt(err), "unable to expand macro")
+			}
+			continue
+		}
+		in.markOp()
+		opPos := in.Position()
 		n, err := parseOp(token, in, currentInstructions)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "unable to parse op code")
+			return nil, errors.Wrap(in.errorAt(err), "unable to parse op code")
 		}
 		if n > 0 {
-			jumpTable = append(jumpTable, len(instructions))
-			instructions = append(instructions, currentInstructions[:n]...)
+			if in.strict {
+				// lines up to this one without instructions of their own continue here
+				for len(program.jumpTable) < in.mainLine {
+					program.jumpTable = append(program.jumpTable, len(program.instructions))
+				}
+			} else {
+				program.jumpTable = append(program.jumpTable, len(program.instructions))
+			}
+			program.sourceMap = append(program.sourceMap, sourcePosition{ip: len(program.instructions), pos: opPos})
+			program.instructions = append(program.instructions, currentInstructions[:n]...)
+			program.ast = append(program.ast, newInstruction(currentInstructions[:n], opPos))
+		}
+	}
+	if in.strict {
+		// trailing lines without instructions end the program
+		for len(program.jumpTable) < in.lexer.line {
+			program.jumpTable = append(program.jumpTable, len(program.instructions))
+		}
+	}
+	if err := in.Err(); err != nil {
+		return nil, errors.Wrap(in.errorAt(err), "unable to scan program")
+	}
+	if in.proc != nil {
+		return nil, in.errorAt(errors.Errorf("proc %s is missing .endproc", in.proc.name))
+	}
+	if in.conditionals > 0 {
+		return nil, in.errorAt(errors.New(".ifdef or .ifndef is missing .endif"))
+	}
+	if err := declareSymbols(in, program); err != nil {
+		return nil, err
+	}
+	if err := resolveStart(in, program); err != nil {
+		return nil, err
+	}
+	return &Unit{program: program, labels: in.labels}, nil
+}
+
+// labelDefinition is a label defined in a program's source
+type labelDefinition struct {
+	name string
+	line int
+	pos  Position
+}
+
+// labelRef is a placeholder for a line number argument given as a
+// label name, replaced by the label's line once every label is defined
+type labelRef struct {
+	name string
+	pos  Position
+}
+
+// lineListRef is a placeholder for a list of line numbers some of which are
+// given as label names, holding an int or a labelRef for each line
+type lineListRef []interface{}
+
+// errorAt returns err as a ParseError at the most recent token,
+// unless it already is one
+func (in *parser) errorAt(err error) error {
+	if _, ok := errors.Cause(err).(*ParseError); ok {
+		return err
+	}
+	return &ParseError{Position: in.Position(), Token: in.Text(), Err: err}
+}
+
+// defineLabel makes name refer to the line of the program's next instruction,
+// recording where it was defined
+func (in *parser) defineLabel(program *Program, name string) error {
+	line := len(program.jumpTable) + 1
+	if err := defineLabel(in.labels, name, line); err != nil {
+		return err
+	}
+	program.labels = append(program.labels, labelDefinition{name: name, line: line, pos: in.Position()})
+	return nil
+}
+
+// defineLabel makes name refer to the 1-based line number line
+func defineLabel(labels map[string]int, name string, line int) error {
+	if !isLabelName(name) {
+		return errors.Errorf("invalid label name %q", name)
+	}
+	if _, ok := labels[name]; ok {
+		return errors.Errorf("duplicate label %s", name)
+	}
+	labels[name] = line
+	return nil
+}
+
+// resolveLabels replaces the label references in the program's
+// instructions with the line numbers of the labels
+func resolveLabels(program *Program, labels map[string]int) error {
+	for index, instruction := range program.instructions {
+		resolved, err := resolveRefs(instruction, func(ref labelRef) (int, error) {
+			line, ok := labels[ref.name]
+			if !ok {
+				return 0, &ParseError{
+					Position: ref.pos,
+					Token:    ref.name,
+					Err:      errors.Errorf("undefined label %s", ref.name),
+				}
+			}
+			return line, nil
+		})
+		if err != nil {
+			return err
+		}
+		program.instructions[index] = resolved
+	}
+	return nil
+}
+
+// resolveRefs returns the instruction with the label references it holds
+// replaced by the lines that resolve returns for them
+func resolveRefs(instruction interface{}, resolve func(labelRef) (int, error)) (interface{}, error) {
+	switch ref := instruction.(type) {
+	case labelRef:
+		return resolve(ref)
+	case lineListRef:
+		lines := make([]int, len(ref))
+		for index, element := range ref {
+			switch element := element.(type) {
+			case int:
+				lines[index] = element
+			case labelRef:
+				line, err := resolve(element)
+				if err != nil {
+					return nil, err
+				}
+				lines[index] = line
+			}
+		}
+		return lines, nil
+	}
+	return instruction, nil
+}
+
+// isLabelName reports whether name can be used as a label.
+// Labels are made of letters, digits and underscores, not starting with a digit.
+func isLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for index, c := range name {
+		if c == '_' || unicode.IsLetter(c) || (index > 0 && unicode.IsDigit(c)) {
+			continue
 		}
+		return false
 	}
+	return true
+}
 
-	return instructions, jumpTable, nil
+// parseDirective applies an assembler directive, which produces no instructions itself
+func parseDirective(token string, in *parser, program *Program) error {
+	switch token {
+	case ".line":
+		file, err := nextString(in)
+		if err != nil {
+			return err
+		}
+		line, err := nextInt(in)
+		if err != nil {
+			return err
+		}
+		program.marks = append(program.marks, sourceMark{
+			ip:   len(program.instructions),
+			file: file,
+			line: line,
+		})
+		return nil
+	case ".data":
+		return parseData(in, program)
+	case ".const":
+		return parseConst(in)
+	case ".macro":
+		return parseMacro(in)
+	case ".include":
+		return parseInclude(in)
+	case ".proc":
+		return parseProc(in, program)
+	case ".endproc":
+		return endProc(in, program)
+	case ".start":
+		return parseStart(in)
+	case ".export", ".extern":
+		return parseSymbol(in, token == ".extern")
+	case ".ifdef", ".ifndef":
+		return parseConditional(in, token == ".ifdef")
+	case ".endif":
+		if in.conditionals == 0 {
+			return errors.New(".endif without .ifdef or .ifndef")
+		}
+		in.conditionals--
+		return nil
+	}
+	return errors.Errorf("invalid directive %s", token)
 }
 
-func parseOp(token string, in *bufio.Scanner, instructions *[16]interface{}) (n int, err error) {
+// parseConst defines a name that stands for the value following it
+// wherever it appears as an argument
+func parseConst(in *parser) error {
+	name, err := nextRawToken(in)
+	if err != nil {
+		return err
+	}
+	if in.Quoted() || !isLabelName(name) {
+		return errors.Errorf("invalid constant name %q", name)
+	}
+	if _, ok := in.consts[name]; ok {
+		return errors.Errorf("duplicate constant %s", name)
+	}
+	value, err := nextToken(in)
+	if err != nil {
+		return err
+	}
+	in.consts[name] = value
+	return nil
+}
+
+// parseConditional tests whether the symbol following the directive is defined.
+// If the result is want, the code up to the matching .endif is parsed as usual,
+// otherwise it is skipped.
+func parseConditional(in *parser, want bool) error {
+	name, err := nextRawToken(in)
+	if err != nil {
+		return err
+	}
+	if in.defines[name] == want {
+		in.conditionals++
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		if !in.Scan() {
+			if err := in.Err(); err != nil {
+				return errors.Wrap(err, "unable to advance scanner")
+			}
+			return errors.Errorf("conditional on %s is missing .endif", name)
+		}
+		if in.Quoted() {
+			continue
+		}
+		switch in.Text() {
+		case ".ifdef", ".ifndef":
+			depth++
+		case ".endif":
+			depth--
+		}
+	}
+	return nil
+}
+
+// parseProc starts a procedure, defining its name as a label of its first line
+func parseProc(in *parser, program *Program) error {
+	name, err := nextRawToken(in)
+	if err != nil {
+		return err
+	}
+	if in.proc != nil {
+		return errors.Errorf("proc %s defined inside proc %s", name, in.proc.name)
+	}
+	if err := in.defineLabel(program, name); err != nil {
+		return err
+	}
+	in.proc = &proc{name: name, start: len(program.jumpTable)}
+	return nil
+}
+
+// endProc ends the current procedure, checking that it cannot
+// continue past its end into the code that follows it
+func endProc(in *parser, program *Program) error {
+	if in.proc == nil {
+		return errors.New(".endproc outside of a proc")
+	}
+	p := in.proc
+	in.proc = nil
+	if len(program.jumpTable) == p.start {
+		return errors.Errorf("proc %s must end in ret or jump", p.name)
+	}
+	last := program.instructions[program.jumpTable[len(program.jumpTable)-1]].(OpCode)
+	if !procTerminators[last] {
+		return errors.Errorf("proc %s must end in ret or jump, not %s", p.name, opMnemonics()[last])
+	}
+	return nil
+}
+
+// Scan advances to the next token, continuing with the including
+// file when the end of an included file is reached
+func (in *parser) Scan() bool {
+	for !in.lexer.Scan() {
+		if in.lexer.Err() != nil || len(in.includes) == 0 {
+			return false
+		}
+		var outer include
+		outer, in.includes = in.includes[len(in.includes)-1], in.includes[:len(in.includes)-1]
+		in.lexer, in.file = outer.lexer, outer.file
+	}
+	if len(in.includes) == 0 && !in.Replayed() {
+		in.mainLine = in.Position().Line
+	}
+	return true
+}
+
+// markOp records the most recent token as the start of an instruction
+func (in *parser) markOp() {
+	if !in.Replayed() {
+		in.lastOp = in.Position()
+	}
+}
+
+// checkLineEnded returns an error in strict mode if the most recent token
+// was read from the same line as the previous instruction
+func checkLineEnded(in *parser) error {
+	if !in.strict || in.Replayed() || !sameLine(in.Position(), in.lastOp) {
+		return nil
+	}
+	return &ParseError{Position: in.Position(), Token: in.Text(), Expected: "end of line"}
+}
+
+func sameLine(a, b Position) bool {
+	return a.File == b.File && a.Line == b.Line
+}
+
+// parseInclude continues reading from the file named by the directive's
+// argument, returning to the current file at the end of it
+func parseInclude(in *parser) error {
+	name, err := nextString(in)
+	if err != nil {
+		return err
+	}
+	path, err := resolveInclude(in, name)
+	if err != nil {
+		return err
+	}
+	open := make([]string, 0, len(in.includes)+1)
+	for _, outer := range in.includes {
+		open = append(open, outer.file)
+	}
+	open = append(open, in.file)
+	for _, file := range open {
+		if file != "" && filepath.Clean(file) == path {
+			return errors.Errorf("include cycle: %s", strings.Join(append(open, path), " -> "))
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read include %s", name)
+	}
+	in.includes = append(in.includes, include{lexer: in.lexer, file: in.file})
+	in.lexer, in.file = newLexer(bytes.NewReader(data), path), path
+	return nil
+}
+
+// resolveInclude finds the file named by an .include directive, looking
+// relative to the current file and then in each directory of the include path
+func resolveInclude(in *parser, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+	candidates := []string{filepath.Join(filepath.Dir(in.file), name)}
+	for _, dir := range in.includePath {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.Errorf("include %s not found", name)
+}
+
+// parseMacro defines a macro. The tokens on the same line as the macro's name
+// name its parameters and the tokens on following lines up to .endmacro are its body.
+func parseMacro(in *parser) error {
+	name, err := nextRawToken(in)
+	if err != nil {
+		return err
+	}
+	if in.Quoted() || !isLabelName(name) {
+		return errors.Errorf("invalid macro name %q", name)
+	}
+	if _, ok := instructionSignatures()[name]; ok {
+		return errors.Errorf("macro name %s is an instruction", name)
+	}
+	if _, ok := in.macros[name]; ok {
+		return errors.Errorf("duplicate macro %s", name)
+	}
+	line := in.Position().Line
+	m := &macro{}
+	for {
+		if !in.Scan() {
+			if err := in.Err(); err != nil {
+				return errors.Wrap(err, "unable to advance scanner")
+			}
+			return errors.Errorf("macro %s is missing .endmacro", name)
+		}
+		t := in.Current()
+		if !t.quoted && t.text == ".endmacro" {
+			break
+		}
+		if t.pos.Line == line && len(m.body) == 0 {
+			if t.quoted || !isLabelName(t.text) {
+				return errors.Errorf("invalid macro parameter %q", t.text)
+			}
+			m.params = append(m.params, t.text)
+			continue
+		}
+		m.body = append(m.body, t)
+	}
+	in.macros[name] = m
+	return nil
+}
+
+// expandMacro reads the arguments of a use of the macro m and queues its body, with
+// parameters replaced by the arguments, to be parsed in place of the macro's name.
+// Tokens of the expansion keep the line numbers they were written on.
+func expandMacro(in *parser, name string, m *macro) error {
+	in.expansions++
+	if in.expansions > maxMacroExpansions {
+		return errors.Errorf("macro %s exceeded %d expansions", name, maxMacroExpansions)
+	}
+	args := make(map[string]token, len(m.params))
+	for _, param := range m.params {
+		if _, err := nextRawToken(in); err != nil {
+			return err
+		}
+		args[param] = in.Current()
+	}
+	expansion := make([]token, len(m.body))
+	for index, t := range m.body {
+		if arg, ok := args[t.text]; ok && !t.quoted {
+			t = arg
+		}
+		expansion[index] = t
+	}
+	in.Unread(expansion)
+	return nil
+}
+
+// constantTypes are the kinds of constants that can be declared in a .data section
+var constantTypes = map[string]ArgType{
+	"int":    ArgInt,
+	"string": ArgString,
+	"float":  ArgFloat,
+	"bool":   ArgBool,
+	"bigint": ArgBigInt,
+}
+
+// parseData reads the entries of a .data section into the constant pool until
+// a .text directive or the end of the program. Each entry is a type followed by
+// its value, and entries are numbered in order across all .data sections.
+func parseData(in *parser, program *Program) error {
+	for in.Scan() {
+		if err := in.Err(); err != nil {
+			return errors.Wrap(err, "unable to advance scanner")
+		}
+		kind := in.Text()
+		if kind == ".text" {
+			return nil
+		}
+		argType, ok := constantTypes[kind]
+		if !ok {
+			return errors.Errorf("invalid constant type %s", kind)
+		}
+		value, err := getArgument(in, argType)
+		if err != nil {
+			return err
+		}
+		program.constants = append(program.constants, value)
+	}
+	return in.Err()
+}
+
+func parseOp(token string, in *parser, instructions *[16]interface{}) (n int, err error) {
+	opPos := in.Position()
 
 	// check for no-argument ops
-	signature, ok := instructionSignatures[token]
+	signature, ok := instructionSignatures()[token]
 	if !ok {
-		return 0, errors.Errorf("invalid instruction %s", token)
+		return 0, &ParseError{Position: in.Position(), Token: token, Expected: "instruction"}
 	}
 
 	instructions[0] = signature.op
@@ -84,6 +765,9 @@ func parseOp(token string, in *bufio.Scanner, instructions *[16]interface{}) (n
 		if err != nil {
 			return 0, err
 		}
+		if in.strict && !sameLine(in.Position(), opPos) {
+			return 0, &ParseError{Position: in.Position(), Token: in.Text(), Expected: argType.String() + " on the line of " + token}
+		}
 		instructions[1+index] = value
 	}
 
@@ -91,32 +775,153 @@ func parseOp(token string, in *bufio.Scanner, instructions *[16]interface{}) (n
 	return n, nil
 }
 
-func getArgument(in *bufio.Scanner, argType ArgType) (interface{}, error) {
+// getArgument reads an argument of the given type, returning a
+// ParseError at the argument if it cannot be read
+func getArgument(in *parser, argType ArgType) (interface{}, error) {
+	value, err := readArgument(in, argType)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*ParseError); ok {
+			return nil, err
+		}
+		parseErr := &ParseError{Position: in.Position(), Token: in.Text(), Expected: argType.String(), Err: err}
+		if err == errEndOfProgram {
+			parseErr.Err = nil
+		}
+		return nil, parseErr
+	}
+	return value, nil
+}
+
+func readArgument(in *parser, argType ArgType) (interface{}, error) {
 	switch argType {
-	case argInt:
+	case ArgInt:
 		return nextInt(in)
-	case argString:
+	case ArgString:
 		return nextString(in)
+	case ArgFloat:
+		return nextFloat(in)
+	case ArgBool:
+		return nextBool(in)
+	case ArgIntList:
+		return nextLineList(in)
+	case ArgBigInt:
+		return nextBigInt(in)
+	case ArgLine:
+		return nextLine(in)
 	}
 	return nil, errors.New("unknown argument type")
 }
 
-func nextInt(in *bufio.Scanner) (int, error) {
-	if !in.Scan() {
-		return 0, errors.New("end of program")
+// nextToken advances to the next argument of an instruction,
+// replacing names defined by .const directives with their values
+func nextToken(in *parser) (string, error) {
+	token, err := nextRawToken(in)
+	if err != nil {
+		return "", err
 	}
-	if err := in.Err(); err != nil {
-		return 0, errors.Wrap(err, "unable to advance scanner")
+	if value, ok := in.consts[token]; ok && !in.Quoted() {
+		return value, nil
 	}
-	return strconv.Atoi(in.Text())
+	return token, nil
 }
 
-func nextString(in *bufio.Scanner) (string, error) {
+// nextRawToken advances to the next token as it is written in the program
+func nextRawToken(in *parser) (string, error) {
 	if !in.Scan() {
-		return "", errors.New("end of program")
-	}
-	if err := in.Err(); err != nil {
-		return "", errors.Wrap(err, "unable to advance scanner")
+		if err := in.Err(); err != nil {
+			return "", errors.Wrap(err, "unable to advance scanner")
+		}
+		return "", errEndOfProgram
 	}
 	return in.Text(), nil
 }
+
+// errEndOfProgram is returned when a program ends before an instruction's arguments
+var errEndOfProgram = errors.New("end of program")
+
+func nextInt(in *parser) (int, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return 0, err
+	}
+	return parseIntLiteral(token)
+}
+
+// nextLine reads a line number, or a reference to a label to be resolved later
+func nextLine(in *parser) (interface{}, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return nil, err
+	}
+	if isLabelName(token) {
+		return labelRef{name: token, pos: in.Position()}, nil
+	}
+	return parseIntLiteral(token)
+}
+
+func nextString(in *parser) (string, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func nextFloat(in *parser) (float64, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(token, 64)
+}
+
+func nextBool(in *parser) (bool, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(token)
+}
+
+// nextLineList reads a list of line numbers, or a list with references to
+// labels to be resolved later if any of its lines are written as labels
+func nextLineList(in *parser) (interface{}, error) {
+	n, err := nextInt(in)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errors.Errorf("invalid list length %d", n)
+	}
+	values := make(lineListRef, 0)
+	refs := false
+	for len(values) < n {
+		value, err := nextLine(in)
+		if err != nil {
+			return nil, err
+		}
+		_, isRef := value.(labelRef)
+		refs = refs || isRef
+		values = append(values, value)
+	}
+	if refs {
+		return values, nil
+	}
+	lines := make([]int, len(values))
+	for index, value := range values {
+		lines[index] = value.(int)
+	}
+	return lines, nil
+}
+
+func nextBigInt(in *parser) (*big.Int, error) {
+	token, err := nextToken(in)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := new(big.Int).SetString(token, 10)
+	if !ok {
+		return nil, errors.Errorf("invalid bigint %s", token)
+	}
+	return value, nil
+}
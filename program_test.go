@@ -0,0 +1,32 @@
+package crust
+
+import (
+	"testing"
+)
+
+func TestJumpTableLabels(t *testing.T) {
+	const body = `
+		jtable 2 first 6 other
+		halt 0
+	first:	spush a
+		put
+		spush b
+		put
+	other:	spush c
+		put
+	`
+	tests := map[string]string{
+		"ipush 0": "abc",
+		"ipush 1": "bc",
+		"ipush 2": "c",
+	}
+	for push, want := range tests {
+		out, err := runSource(t, push+body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Fatalf("%s: expected %q, got %q", push, want, out)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// record is a mutable set of named fields.
+// Records are shared by reference when copied on the stack.
+type record struct {
+	// fields holds field names in the order they were first set
+	fields []string
+	values map[string]interface{}
+}
+
+func newRecord() *record {
+	return &record{values: make(map[string]interface{})}
+}
+
+func (r *record) String() string {
+	parts := make([]string, len(r.fields))
+	for index, field := range r.fields {
+		parts[index] = fmt.Sprintf("%s=%v", field, r.values[field])
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func (r *record) get(field string) (interface{}, error) {
+	value, ok := r.values[field]
+	if !ok {
+		return nil, errors.Errorf("record field %s not found", field)
+	}
+	return value, nil
+}
+
+func (r *record) set(field string, value interface{}) {
+	if _, ok := r.values[field]; !ok {
+		r.fields = append(r.fields, field)
+	}
+	r.values[field] = value
+}
@@ -0,0 +1,190 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+)
+
+// maxInstructionArgs is the most arguments an instruction can take,
+// limited by the buffer the parser reads instructions into
+const maxInstructionArgs = 15
+
+// instructionTables are the instructions of the assembly language. Tables are
+// never modified once stored in instructions: registering an instruction stores
+// a copy with the instruction added, so that the tables can be read without
+// locking while other instructions are registered.
+type instructionTables struct {
+	// signatures maps mnemonics to the instructions they write
+	signatures map[string]instructionSignature
+
+	// mnemonics is the reverse of signatures, mapping op codes
+	// back to the mnemonic used to write them
+	mnemonics map[OpCode]string
+}
+
+var (
+	// instructions holds the current *instructionTables
+	instructions atomic.Value
+
+	// registry serializes registering instructions
+	registry sync.Mutex
+)
+
+func init() {
+	mnemonics := make(map[OpCode]string, len(builtinSignatures))
+	for mnemonic, signature := range builtinSignatures {
+		mnemonics[signature.op] = mnemonic
+	}
+	instructions.Store(&instructionTables{signatures: builtinSignatures, mnemonics: mnemonics})
+}
+
+// instructionSignatures returns the signatures of the instructions by mnemonic,
+// which must not be modified
+func instructionSignatures() map[string]instructionSignature {
+	return instructions.Load().(*instructionTables).signatures
+}
+
+// opMnemonics returns the mnemonics that op codes are written with,
+// which must not be modified
+func opMnemonics() map[OpCode]string {
+	return instructions.Load().(*instructionTables).mnemonics
+}
+
+// RegisterInstruction makes mnemonic an instruction of the assembly language
+// with op code op, taking arguments of the given types. If op is the op code of
+// an instruction already, mnemonic is another name for it and must take the same
+// arguments; programs are still disassembled with the instruction's first name.
+// Otherwise op is a new instruction, which interpreters run with the function
+// registered with RegisterInstructionFunc. Instructions can be registered while
+// other programs are parsed, decoded or run, and are available to the programs
+// parsed, decoded or built after they are registered.
+func RegisterInstruction(mnemonic string, op OpCode, args ...ArgType) error {
+	registry.Lock()
+	defer registry.Unlock()
+	return registerInstruction(mnemonic, op, args)
+}
+
+// RegisterAlias makes alias another name for the instruction written as mnemonic
+func RegisterAlias(alias, mnemonic string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	signature, ok := instructionSignatures()[mnemonic]
+	if !ok {
+		return errors.Errorf("unknown instruction %s", mnemonic)
+	}
+	return registerInstruction(alias, signature.op, signature.args)
+}
+
+// registerInstruction stores tables with the instruction added, while registry is held
+func registerInstruction(mnemonic string, op OpCode, args []ArgType) error {
+	if err := checkMnemonic(mnemonic); err != nil {
+		return err
+	}
+	if len(args) > maxInstructionArgs {
+		return errors.Errorf("instruction %s takes %d arguments, at most %d are allowed", mnemonic, len(args), maxInstructionArgs)
+	}
+	for _, argType := range args {
+		if _, ok := argTypeNames[argType]; !ok {
+			return errors.Errorf("invalid argument type %d for instruction %s", argType, mnemonic)
+		}
+	}
+	for _, s := range superinstructions {
+		if op == s.fused {
+			return errors.Errorf("op code %d is reserved", op)
+		}
+	}
+	current := instructions.Load().(*instructionTables)
+	if existing, ok := current.mnemonics[op]; ok {
+		if !sameArgTypes(current.signatures[existing].args, args) {
+			return errors.Errorf("op code %d is %s, which takes %v arguments", op, existing, current.signatures[existing].args)
+		}
+	}
+	tables := &instructionTables{
+		signatures: make(map[string]instructionSignature, len(current.signatures)+1),
+		mnemonics:  make(map[OpCode]string, len(current.mnemonics)+1),
+	}
+	for name, signature := range current.signatures {
+		tables.signatures[name] = signature
+	}
+	for code, name := range current.mnemonics {
+		tables.mnemonics[code] = name
+	}
+	if _, ok := tables.mnemonics[op]; !ok {
+		tables.mnemonics[op] = mnemonic
+	}
+	tables.signatures[mnemonic] = instructionSignature{op: op, args: append([]ArgType(nil), args...)}
+	instructions.Store(tables)
+	return nil
+}
+
+// checkMnemonic returns an error if mnemonic cannot be registered as an instruction
+func checkMnemonic(mnemonic string) error {
+	if !isLabelName(mnemonic) {
+		return errors.Errorf("invalid mnemonic %q", mnemonic)
+	}
+	if _, ok := instructionSignatures()[mnemonic]; ok {
+		return errors.Errorf("instruction %s is already defined", mnemonic)
+	}
+	return nil
+}
+
+func sameArgTypes(a, b []ArgType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// InstructionFunc runs an instruction registered with RegisterInstruction. It
+// receives the instruction's arguments in the order of its signature and the
+// values it consumes from the stack in the order they were pushed. Its results
+// are pushed in order.
+type InstructionFunc func(args, operands []Value) ([]Value, error)
+
+// instructionFunc is an InstructionFunc and the number of values it consumes
+type instructionFunc struct {
+	argc int
+	fn   InstructionFunc
+}
+
+// RegisterInstructionFunc makes fn run the instructions registered with
+// RegisterInstruction as op code op, consuming argc values from the stack,
+// replacing any function previously registered for it
+func (i *Interpreter) RegisterInstructionFunc(op OpCode, argc int, fn InstructionFunc) {
+	i.instructionFuncs[op] = instructionFunc{argc: argc, fn: fn}
+}
+
+// executeRegistered runs an instruction registered with RegisterInstruction
+func (i *Interpreter) executeRegistered(op OpCode) error {
+	mnemonic, ok := opMnemonics()[op]
+	if !ok {
+		return errors.Errorf("invalid op code: %v", op)
+	}
+	registered, ok := i.instructionFuncs[op]
+	if !ok {
+		return errors.Errorf("no function registered for instruction %s", mnemonic)
+	}
+	signature := instructionSignatures()[mnemonic]
+	args := make([]Value, len(signature.args))
+	for index := range args {
+		arg, err := i.nextInstruction()
+		if err != nil {
+			return errors.Errorf("instruction %s is missing its arguments", mnemonic)
+		}
+		args[index] = arg
+	}
+	operands, results, err := i.callHostFunc(func(operands []Value) ([]Value, error) {
+		return registered.fn(args, operands)
+	}, registered.argc)
+	if err != nil {
+		return errors.Wrapf(err, "instruction %s failed", mnemonic)
+	}
+	i.dlog("%s %v %v => %v", mnemonic, args, operands, results)
+	return nil
+}
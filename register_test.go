@@ -0,0 +1,109 @@
+package crust
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// opAddArg is an instruction registered for the tests, adding its argument to the top of the stack
+const opAddArg = OpCode(205)
+
+var registerAddArg sync.Once
+
+func TestRegisteredInstructions(t *testing.T) {
+	registerAddArg.Do(func() {
+		if err := RegisterInstruction("addarg", opAddArg, ArgInt); err != nil {
+			t.Fatal(err)
+		}
+		if err := RegisterAlias("print", InstructionPut); err != nil {
+			t.Fatal(err)
+		}
+	})
+	program, err := NewProgramFromReader(strings.NewReader("ipush 2\naddarg 40\nprint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	interpreter := NewInterpreter(program, WithStdout(&out))
+	interpreter.RegisterInstructionFunc(opAddArg, 1, func(args, operands []Value) ([]Value, error) {
+		return []Value{operands[0].(int) + args[0].(int)}, nil
+	})
+	if err := interpreter.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "42" {
+		t.Fatalf("expected 42, got %q", out.String())
+	}
+	var text bytes.Buffer
+	if err := program.Disassemble(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "addarg 40") || !strings.Contains(text.String(), InstructionPut) {
+		t.Fatalf("expected the registered instruction and the alias's first name, got %q", text.String())
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	if err := RegisterInstruction(InstructionPut, OpCode(206)); err == nil {
+		t.Fatal("expected an error registering an existing mnemonic")
+	}
+	if err := RegisterInstruction("badargs", OpPut, ArgInt); err == nil {
+		t.Fatal("expected an error registering an op code with different arguments")
+	}
+	if err := RegisterAlias("nothing", "missing"); err == nil {
+		t.Fatal("expected an error aliasing an unknown instruction")
+	}
+}
+
+// aliases counts the aliases registered by TestRegisterWhileRunning,
+// which must be new each time the test runs
+var aliases int
+
+func TestRegisterWhileRunning(t *testing.T) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				program, err := NewProgramFromReader(strings.NewReader("ipush 1\nipush 2\niadd\nput"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var out bytes.Buffer
+				if err := NewInterpreter(program, WithStdout(&out)).Run(); err != nil || out.String() != "3" {
+					t.Errorf("expected 3, got %q, %v", out.String(), err)
+					return
+				}
+			}
+		}()
+	}
+	var last string
+	for n := 0; n < 50; n++ {
+		aliases++
+		last = fmt.Sprintf("plus%d", aliases)
+		if err := RegisterAlias(last, InstructionIadd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	out, err := runSource(t, "ipush 1\nipush 2\n"+last+"\nput")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "3" {
+		t.Fatalf("expected the alias to add, got %q", out)
+	}
+}
@@ -0,0 +1,68 @@
+package crust
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sourceMark records that the instructions starting at ip were generated
+// from a line of another source file, as declared by a .line directive
+type sourceMark struct {
+	ip   int
+	file string
+	line int
+}
+
+func (m sourceMark) String() string {
+	return fmt.Sprintf("%s:%d", m.file, m.line)
+}
+
+// sourceOf returns the source position the instruction index ip was
+// generated from, if any .line directive precedes it
+func (p *Program) sourceOf(ip int) (sourceMark, bool) {
+	index := sort.Search(len(p.marks), func(index int) bool {
+		return p.marks[index].ip > ip
+	})
+	if index == 0 {
+		return sourceMark{}, false
+	}
+	return p.marks[index-1], true
+}
+
+// sourcePosition records where the instruction starting at ip was written
+type sourcePosition struct {
+	ip  int
+	pos Position
+}
+
+// PositionOf returns where the instruction at or containing the instruction
+// index ip was written, false if the program was not parsed from source
+func (p *Program) PositionOf(ip int) (Position, bool) {
+	index := sort.Search(len(p.sourceMap), func(index int) bool {
+		return p.sourceMap[index].ip > ip
+	})
+	if index == 0 {
+		return Position{}, false
+	}
+	return p.sourceMap[index-1].pos, true
+}
+
+// locate returns where the instruction index ip came from for error messages,
+// preferring the source declared by a .line directive to where it was written.
+// Instructions of programs that were not parsed from source are located by line number.
+func (p *Program) locate(ip int) fmt.Stringer {
+	if mark, ok := p.sourceOf(ip); ok {
+		return mark
+	}
+	if pos, ok := p.PositionOf(ip); ok {
+		return pos
+	}
+	return programLine(p.lineOf(ip))
+}
+
+// programLine is the line number of an instruction in a program without a source
+type programLine int
+
+func (l programLine) String() string {
+	return fmt.Sprintf("line %d", int(l))
+}
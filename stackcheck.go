@@ -0,0 +1,437 @@
+package crust
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// stackEffect is how an instruction changes the stack: the number of values
+// it consumes and the number of values it leaves in their place
+type stackEffect struct {
+	pops   int
+	pushes int
+}
+
+// stackEffects are the effects of the instructions that always change the
+// stack the same way. Instructions that change the flow of control between
+// calls or whose effect depends on the program's state are not included.
+var stackEffects = map[OpCode]stackEffect{
+	OpPutln:      {0, 0},
+	OpDup:        {1, 2},
+	OpPut:        {1, 0},
+	OpJump:       {0, 0},
+	OpShowInstr:  {0, 1},
+	OpHalt:       {0, 0},
+	OpNop:        {0, 0},
+	OpLoadc:      {0, 1},
+	OpIpush:      {0, 1},
+	OpIadd:       {2, 1},
+	OpImultiply:  {2, 1},
+	OpIsubtract:  {2, 1},
+	OpIdivide:    {2, 1},
+	OpImodulo:    {2, 1},
+	OpInegate:    {1, 1},
+	OpIabsolute:  {1, 1},
+	OpIincrement: {1, 1},
+
+	OpSpush: {0, 1},
+	OpSadd:  {2, 1},
+	OpSsub:  {3, 1},
+	OpSchar: {2, 1},
+	OpSlen:  {1, 1},
+	OpSblen: {1, 1},
+	OpSeq:   {2, 1},
+	OpScmp:  {2, 1},
+
+	OpFpush:     {0, 1},
+	OpFadd:      {2, 1},
+	OpFsubtract: {2, 1},
+	OpFmultiply: {2, 1},
+	OpFdivide:   {2, 1},
+
+	OpBand:       {2, 1},
+	OpBor:        {2, 1},
+	OpBxor:       {2, 1},
+	OpBnot:       {1, 1},
+	OpShiftLeft:  {2, 1},
+	OpShiftRight: {2, 1},
+
+	OpIequal:        {2, 1},
+	OpInotEqual:     {2, 1},
+	OpIlessThan:     {2, 1},
+	OpIlessEqual:    {2, 1},
+	OpIgreaterThan:  {2, 1},
+	OpIgreaterEqual: {2, 1},
+
+	OpBpush: {0, 1},
+	OpAnd:   {2, 1},
+	OpOr:    {2, 1},
+	OpNot:   {1, 1},
+
+	OpJumpLessThan:     {1, 0},
+	OpJumpEqual:        {1, 0},
+	OpJumpNotEqual:     {1, 0},
+	OpJumpGreaterThan:  {1, 0},
+	OpJumpGreaterEqual: {1, 0},
+	OpJumpLessEqual:    {1, 0},
+	OpJumpZero:         {1, 0},
+	OpJumpNotZero:      {1, 0},
+	OpJumpDynamic:      {1, 0},
+	OpJumpTable:        {1, 0},
+
+	OpSwap:  {2, 2},
+	OpOver:  {2, 3},
+	OpRot:   {3, 3},
+	OpDrop:  {1, 0},
+	OpDepth: {0, 1},
+
+	OpLoadl:  {0, 1},
+	OpStorel: {1, 0},
+	OpCpush:  {0, 1},
+	OpSpawn:  {0, 0},
+	OpYield:  {0, 0},
+
+	OpGload:  {0, 1},
+	OpGstore: {1, 0},
+	OpLoad:   {0, 1},
+	OpStore:  {1, 0},
+
+	OpAlloc:  {0, 1},
+	OpFree:   {1, 0},
+	OpRload:  {1, 1},
+	OpRstore: {2, 0},
+	OpMload:  {0, 1},
+	OpMstore: {1, 0},
+
+	OpAnew:  {0, 1},
+	OpAget:  {2, 1},
+	OpAset:  {3, 1},
+	OpAlen:  {1, 1},
+	OpApush: {2, 1},
+
+	OpMnew: {0, 1},
+	OpMget: {2, 1},
+	OpMset: {3, 1},
+	OpMhas: {2, 1},
+	OpMdel: {2, 1},
+	OpMlen: {1, 1},
+
+	OpSupper:   {1, 1},
+	OpSlower:   {1, 1},
+	OpStrim:    {1, 1},
+	OpSsplit:   {2, 1},
+	OpSjoin:    {2, 1},
+	OpSfind:    {2, 1},
+	OpSreplace: {3, 1},
+	OpSbytes:   {1, 1},
+
+	OpReadi:    {0, 1},
+	OpReads:    {0, 1},
+	OpReadline: {0, 1},
+	OpEput:     {1, 0},
+	OpEputln:   {0, 0},
+
+	OpItos:   {1, 1},
+	OpStoi:   {1, 1},
+	OpChr:    {1, 1},
+	OpOrd:    {1, 1},
+	OpTypeof: {1, 2},
+
+	OpAssert: {1, 0},
+	OpBrk:    {0, 0},
+	OpBtrace: {0, 1},
+
+	OpTry:    {0, 0},
+	OpThrow:  {1, 0},
+	OpEndTry: {0, 0},
+
+	OpRand:    {1, 1},
+	OpNow:     {0, 1},
+	OpElapsed: {0, 1},
+	OpSleep:   {0, 0},
+	OpGetenv:  {0, 1},
+	OpFread:   {1, 1},
+	OpFwrite:  {2, 0},
+
+	OpChnew:  {0, 1},
+	OpChsend: {2, 0},
+	OpChrecv: {1, 1},
+
+	OpMin:  {2, 1},
+	OpMax:  {2, 1},
+	OpPow:  {2, 1},
+	OpSqrt: {1, 1},
+
+	OpBigpush:     {0, 1},
+	OpBigadd:      {2, 1},
+	OpBigsubtract: {2, 1},
+	OpBigmultiply: {2, 1},
+	OpBigdivide:   {2, 1},
+
+	OpNpush: {0, 1},
+	OpJnil:  {1, 0},
+	OpJrel:  {0, 0},
+	OpJrell: {1, 0},
+
+	OpRnew: {0, 1},
+	OpRget: {1, 1},
+	OpRset: {2, 1},
+
+	OpBnew: {1, 1},
+	OpBget: {2, 1},
+	OpBset: {3, 1},
+	OpBlen: {1, 1},
+	OpBstr: {1, 1},
+}
+
+// effectOf returns the stack effect of the instruction op at ip,
+// false if it cannot be known without running the program
+func (p *Program) effectOf(ip int, op OpCode) (stackEffect, bool) {
+	args := p.instructions[ip+1:]
+	switch op {
+	case OpPick:
+		n := args[0].(int)
+		return stackEffect{n + 1, n + 2}, n >= 0
+	case OpDupn:
+		n := args[0].(int)
+		return stackEffect{n, 2 * n}, n >= 0
+	case OpSfmt:
+		return stackEffect{countVerbs(args[0].(string)), 1}, true
+	case OpPutf:
+		return stackEffect{countVerbs(args[0].(string)), 0}, true
+	}
+	effect, ok := stackEffects[op]
+	return effect, ok
+}
+
+// CheckStack simulates the depth of the stack along every path through the
+// program without running it, reporting instructions that would consume more
+// values than the stack holds and instructions that paths reach with different
+// stack depths. Calls are followed into the called procedure to find how many
+// values it consumes and leaves. The depth is not tracked past instructions
+// whose effect depends on the program's state, such as calli, hostcall and
+// dedup, or into procedures that do not always return with the same depth.
+// It returns an error if the program fails Verify.
+func CheckStack(program *Program) ([]Diagnostic, error) {
+	if err := Verify(program); err != nil {
+		return nil, errors.Wrap(err, "unable to check stack")
+	}
+	a := &stackAnalysis{
+		program:   program,
+		reported:  make(map[Diagnostic]bool),
+		summaries: make(map[int]*procSummary),
+	}
+	entry := 0
+	if program.entry != 0 {
+		entry, _ = program.lineStart(program.entry)
+	}
+	a.region(entry, false)
+
+	// spawned coroutines start with their own empty stack, and functions
+	// pushed by cpush are called with the stack of whoever calls them
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		if op != OpSpawn && op != OpCpush {
+			return nil
+		}
+		if target, ok := program.lineStart(program.instructions[ip+1].(int)); ok {
+			if op == OpSpawn {
+				a.region(target, false)
+			} else {
+				a.summary(target)
+			}
+		}
+		return nil
+	})
+	sortDiagnostics(a.diagnostics)
+	return a.diagnostics, nil
+}
+
+// stackDepth is the depth of the stack at an instruction. In a procedure it is
+// relative to the depth the procedure was called with, and can be negative.
+type stackDepth struct {
+	depth int
+	known bool
+}
+
+// procSummary is how calling a procedure changes the stack: the number of the
+// caller's values it consumes and the change in depth when it returns
+type procSummary struct {
+	needs int
+	net   int
+	known bool
+}
+
+// stackAnalysis is the state of CheckStack
+type stackAnalysis struct {
+	program     *Program
+	diagnostics []Diagnostic
+	reported    map[Diagnostic]bool
+
+	// summaries are the procedures called so far by the instruction position
+	// they start at, nil while a procedure is being analyzed
+	summaries map[int]*procSummary
+}
+
+func (a *stackAnalysis) report(ip int, format string, args ...interface{}) {
+	d := a.program.diagnostic(ip, format, args...)
+	if !a.reported[d] {
+		a.reported[d] = true
+		a.diagnostics = append(a.diagnostics, d)
+	}
+}
+
+// summary returns how calling the procedure starting at target changes the stack,
+// analyzing it the first time it is called. Recursive calls are not known.
+func (a *stackAnalysis) summary(target int) procSummary {
+	if summary, ok := a.summaries[target]; ok {
+		if summary == nil {
+			return procSummary{}
+		}
+		return *summary
+	}
+	a.summaries[target] = nil
+	summary := a.region(target, true)
+	a.summaries[target] = &summary
+	return summary
+}
+
+// region simulates the stack from the instruction position start through every
+// instruction reachable from it. The stack is empty at start unless the region is
+// a procedure, in which case values below start belong to the caller and the
+// region's summary is returned.
+func (a *stackAnalysis) region(start int, procedure bool) procSummary {
+	p := a.program
+	depths := map[int]stackDepth{start: {0, true}}
+	work := []int{start}
+	lowest := 0
+	returned := make(map[int]bool)
+	returnsKnown := true
+
+	reach := func(ip int, next stackDepth) {
+		if ip >= len(p.instructions) {
+			return
+		}
+		previous, ok := depths[ip]
+		if !ok {
+			depths[ip] = next
+			work = append(work, ip)
+			return
+		}
+		if previous.known && next.known && previous.depth != next.depth {
+			a.report(ip, "stack depth is %d on one path and %d on another", previous.depth, next.depth)
+		}
+	}
+	// consume checks that n values can be consumed from the stack
+	consume := func(ip int, current stackDepth, n int, what string) stackDepth {
+		if !current.known {
+			return current
+		}
+		if current.depth < n {
+			if procedure {
+				if current.depth-n < lowest {
+					lowest = current.depth - n
+				}
+			} else {
+				a.report(ip, "%s consumes %d values but the stack holds %d", what, n, current.depth)
+				return stackDepth{}
+			}
+		}
+		return stackDepth{current.depth - n, true}
+	}
+	call := func(ip int, current stackDepth, line int) stackDepth {
+		target, ok := p.lineStart(line)
+		if !ok {
+			return stackDepth{}
+		}
+		summary := a.summary(target)
+		if !summary.known {
+			return stackDepth{}
+		}
+		after := consume(ip, current, summary.needs, fmt.Sprintf("call to line %d", line))
+		if !after.known {
+			return after
+		}
+		// the procedure's net change already counts the values it consumes
+		return stackDepth{after.depth + summary.needs + summary.net, true}
+	}
+	ret := func(current stackDepth) {
+		if !current.known {
+			returnsKnown = false
+			return
+		}
+		returned[current.depth] = true
+	}
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		current := depths[ip]
+		op := p.instructions[ip].(OpCode)
+		mnemonic := opMnemonics()[op]
+		signature := instructionSignatures()[mnemonic]
+		next := current
+
+		switch op {
+		case OpCall:
+			next = call(ip, current, p.instructions[ip+1].(int))
+		case OpTailCall:
+			next = call(ip, current, p.instructions[ip+1].(int))
+			if procedure {
+				ret(next)
+				continue
+			}
+		case OpReturn:
+			if procedure {
+				ret(current)
+			}
+			continue
+		case OpCalli:
+			consume(ip, current, 1, mnemonic)
+			next = stackDepth{}
+		case OpHostcall:
+			consume(ip, current, p.instructions[ip+2].(int), mnemonic)
+			next = stackDepth{}
+		case OpClear:
+			next = stackDepth{0, !procedure}
+		default:
+			effect, ok := p.effectOf(ip, op)
+			if !ok {
+				next = stackDepth{}
+				break
+			}
+			next = consume(ip, current, effect.pops, mnemonic)
+			if next.known {
+				next.depth += effect.pushes
+			}
+		}
+
+		targets, continues := p.flowOf(ip, op)
+		for _, target := range targets {
+			if op == OpTry {
+				// the handler resumes with the stack as it was here, plus the exception
+				handler := current
+				if handler.known {
+					handler.depth++
+				}
+				reach(target, handler)
+				continue
+			}
+			reach(target, next)
+		}
+		if continues {
+			reach(ip+1+len(signature.args), next)
+		}
+	}
+
+	if !procedure || !returnsKnown || len(returned) != 1 {
+		if procedure && len(returned) > 1 {
+			a.report(start, "procedure returns with different stack depths")
+		}
+		return procSummary{}
+	}
+	summary := procSummary{needs: -lowest, known: true}
+	for depth := range returned {
+		summary.net = depth
+	}
+	return summary
+}
@@ -0,0 +1,73 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Symbol is a label that a unit shares with the units it is linked with,
+// either exported by the unit or declared extern to be found in another
+type Symbol struct {
+	Name string
+
+	// Line is the 1-based line number the symbol refers to, 0 for an extern
+	Line int
+
+	// Extern is whether the symbol is defined by another unit
+	Extern bool
+}
+
+// Symbols returns the program's exported and extern symbols, in the order they were declared
+func (p *Program) Symbols() []Symbol {
+	return append([]Symbol(nil), p.symbols...)
+}
+
+// parseSymbol reads the label named by an .export or .extern directive
+func parseSymbol(in *parser, extern bool) error {
+	name, err := nextRawToken(in)
+	if err != nil {
+		return err
+	}
+	pos := in.Position()
+	if !isLabelName(name) {
+		return errors.Errorf("invalid symbol name %q", name)
+	}
+	for _, declared := range append(append([]token(nil), in.exports...), in.externs...) {
+		if declared.text == name {
+			return errors.Errorf("duplicate symbol declaration %s", name)
+		}
+	}
+	declared := token{text: name, pos: pos}
+	if extern {
+		in.externs = append(in.externs, declared)
+	} else {
+		in.exports = append(in.exports, declared)
+	}
+	return nil
+}
+
+// declareSymbols adds the symbols declared by .export and .extern directives to
+// the program, checking that exports are defined and externs are not
+func declareSymbols(in *parser, program *Program) error {
+	for _, export := range in.exports {
+		line, ok := in.labels[export.text]
+		if !ok {
+			return &ParseError{
+				Position: export.pos,
+				Token:    export.text,
+				Err:      errors.Errorf("exported label %s is not defined", export.text),
+			}
+		}
+		program.symbols = append(program.symbols, Symbol{Name: export.text, Line: line})
+	}
+	for _, extern := range in.externs {
+		if _, ok := in.labels[extern.text]; ok {
+			return &ParseError{
+				Position: extern.pos,
+				Token:    extern.text,
+				Err:      errors.Errorf("extern symbol %s is defined in this unit", extern.text),
+			}
+		}
+		program.symbols = append(program.symbols, Symbol{Name: extern.text, Extern: true})
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// kindAny is a value of any kind. As the kind of a value on the stack,
+// it is a value whose kind is not known.
+const kindAny = ""
+
+// kinds accepted in place of each other, by conditional jumps,
+// by bigint arithmetic and by map keys
+const (
+	kindIntOrBool   = "int or bool"
+	kindBigIntOrInt = "bigint or int"
+	kindKey         = "string or int"
+)
+
+// kindSignature is the kinds of the values an instruction consumes, deepest
+// first, and the kinds of the values it leaves in their place
+type kindSignature struct {
+	in  []string
+	out []string
+}
+
+// kinds returns the names of the kinds in a kindSignature
+func kinds(names ...string) []string {
+	return names
+}
+
+// kindSignatures are the kinds consumed and left by the instructions that
+// require values of a kind or always leave values of a kind. Instructions that
+// move values around the stack are handled by transferKinds, and instructions
+// not listed leave values whose kinds are not known.
+var kindSignatures = map[OpCode]kindSignature{
+	OpShowInstr:  {nil, kinds("string")},
+	OpIpush:      {nil, kinds("int")},
+	OpIadd:       {kinds("int", "int"), kinds("int")},
+	OpImultiply:  {kinds("int", "int"), kinds("int")},
+	OpIsubtract:  {kinds("int", "int"), kinds("int")},
+	OpIdivide:    {kinds("int", "int"), kinds("int")},
+	OpImodulo:    {kinds("int", "int"), kinds("int")},
+	OpInegate:    {kinds("int"), kinds("int")},
+	OpIabsolute:  {kinds("int"), kinds("int")},
+	OpIincrement: {kinds("int"), kinds("int")},
+
+	OpSpush: {nil, kinds("string")},
+	OpSadd:  {kinds("string", "string"), kinds("string")},
+	OpSsub:  {kinds("string", "int", "int"), kinds("string")},
+	OpSchar: {kinds("string", "int"), kinds("string")},
+	OpSlen:  {kinds("string"), kinds("int")},
+	OpSblen: {kinds("string"), kinds("int")},
+	OpSeq:   {kinds("string", "string"), kinds("bool")},
+	OpScmp:  {kinds("string", "string"), kinds("int")},
+
+	OpFpush:     {nil, kinds("float")},
+	OpFadd:      {kinds("float", "float"), kinds("float")},
+	OpFsubtract: {kinds("float", "float"), kinds("float")},
+	OpFmultiply: {kinds("float", "float"), kinds("float")},
+	OpFdivide:   {kinds("float", "float"), kinds("float")},
+
+	OpBand:       {kinds("int", "int"), kinds("int")},
+	OpBor:        {kinds("int", "int"), kinds("int")},
+	OpBxor:       {kinds("int", "int"), kinds("int")},
+	OpBnot:       {kinds("int"), kinds("int")},
+	OpShiftLeft:  {kinds("int", "int"), kinds("int")},
+	OpShiftRight: {kinds("int", "int"), kinds("int")},
+
+	OpIequal:        {kinds("int", "int"), kinds("bool")},
+	OpInotEqual:     {kinds("int", "int"), kinds("bool")},
+	OpIlessThan:     {kinds("int", "int"), kinds("bool")},
+	OpIlessEqual:    {kinds("int", "int"), kinds("bool")},
+	OpIgreaterThan:  {kinds("int", "int"), kinds("bool")},
+	OpIgreaterEqual: {kinds("int", "int"), kinds("bool")},
+
+	OpBpush: {nil, kinds("bool")},
+	OpAnd:   {kinds("bool", "bool"), kinds("bool")},
+	OpOr:    {kinds("bool", "bool"), kinds("bool")},
+	OpNot:   {kinds("bool"), kinds("bool")},
+
+	OpJumpLessThan:     {kinds(kindIntOrBool), nil},
+	OpJumpEqual:        {kinds(kindIntOrBool), nil},
+	OpJumpNotEqual:     {kinds(kindIntOrBool), nil},
+	OpJumpGreaterThan:  {kinds(kindIntOrBool), nil},
+	OpJumpGreaterEqual: {kinds(kindIntOrBool), nil},
+	OpJumpLessEqual:    {kinds(kindIntOrBool), nil},
+	OpJumpZero:         {kinds(kindIntOrBool), nil},
+	OpJumpNotZero:      {kinds(kindIntOrBool), nil},
+	OpJumpDynamic:      {kinds("int"), nil},
+	OpJumpTable:        {kinds("int"), nil},
+	OpJrell:            {kinds(kindIntOrBool), nil},
+	OpAssert:           {kinds(kindIntOrBool), nil},
+
+	OpDepth: {nil, kinds("int")},
+	OpCpush: {nil, kinds("function")},
+
+	OpAlloc:  {nil, kinds("ref")},
+	OpFree:   {kinds("ref"), nil},
+	OpRload:  {kinds("ref"), kinds(kindAny)},
+	OpRstore: {kinds("ref", kindAny), nil},
+	OpMload:  {nil, kinds("int")},
+	OpMstore: {kinds("int"), nil},
+
+	OpAnew:  {nil, kinds("array")},
+	OpAget:  {kinds("array", "int"), kinds(kindAny)},
+	OpAset:  {kinds("array", "int", kindAny), kinds("array")},
+	OpAlen:  {kinds("array"), kinds("int")},
+	OpApush: {kinds("array", kindAny), kinds("array")},
+
+	OpMnew: {nil, kinds("map")},
+	OpMget: {kinds("map", kindKey), kinds(kindAny)},
+	OpMset: {kinds("map", kindKey, kindAny), kinds("map")},
+	OpMhas: {kinds("map", kindKey), kinds("bool")},
+	OpMdel: {kinds("map", kindKey), kinds("map")},
+	OpMlen: {kinds("map"), kinds("int")},
+
+	OpSupper:   {kinds("string"), kinds("string")},
+	OpSlower:   {kinds("string"), kinds("string")},
+	OpStrim:    {kinds("string"), kinds("string")},
+	OpSsplit:   {kinds("string", "string"), kinds("array")},
+	OpSjoin:    {kinds("array", "string"), kinds("string")},
+	OpSfind:    {kinds("string", "string"), kinds("int")},
+	OpSreplace: {kinds("string", "string", "string"), kinds("string")},
+	OpSbytes:   {kinds("string"), kinds("bytes")},
+
+	OpReadi:    {nil, kinds("int")},
+	OpReads:    {nil, kinds("string")},
+	OpReadline: {nil, kinds("string")},
+
+	OpItos: {kinds("int"), kinds("string")},
+	OpStoi: {kinds("string"), kinds("int")},
+	OpChr:  {kinds("int"), kinds("string")},
+	OpOrd:  {kinds("string"), kinds("int")},
+
+	OpBtrace: {nil, kinds("array")},
+
+	OpRand:    {kinds("int"), kinds("int")},
+	OpNow:     {nil, kinds("int")},
+	OpElapsed: {nil, kinds("int")},
+	OpGetenv:  {nil, kinds("string")},
+	OpFread:   {kinds("string"), kinds("string")},
+	OpFwrite:  {kinds("string", "string"), nil},
+
+	OpChnew:  {nil, kinds("channel")},
+	OpChsend: {kinds("channel", kindAny), nil},
+	OpChrecv: {kinds("channel"), kinds(kindAny)},
+
+	OpMin:  {kinds("int", "int"), kinds("int")},
+	OpMax:  {kinds("int", "int"), kinds("int")},
+	OpPow:  {kinds("int", "int"), kinds("int")},
+	OpSqrt: {kinds("float"), kinds("float")},
+
+	OpBigpush:     {nil, kinds("bigint")},
+	OpBigadd:      {kinds(kindBigIntOrInt, kindBigIntOrInt), kinds("bigint")},
+	OpBigsubtract: {kinds(kindBigIntOrInt, kindBigIntOrInt), kinds("bigint")},
+	OpBigmultiply: {kinds(kindBigIntOrInt, kindBigIntOrInt), kinds("bigint")},
+	OpBigdivide:   {kinds(kindBigIntOrInt, kindBigIntOrInt), kinds("bigint")},
+
+	OpNpush: {nil, kinds("nil")},
+
+	OpRnew: {nil, kinds("record")},
+	OpRget: {kinds("record"), kinds(kindAny)},
+	OpRset: {kinds("record", kindAny), kinds("record")},
+
+	OpBnew: {kinds("int"), kinds("bytes")},
+	OpBget: {kinds("bytes", "int"), kinds("int")},
+	OpBset: {kinds("bytes", "int", "int"), kinds("bytes")},
+	OpBlen: {kinds("bytes"), kinds("int")},
+	OpBstr: {kinds("bytes"), kinds("string")},
+}
+
+// acceptsKind reports whether a value of kind found can be consumed where want is expected
+func acceptsKind(want, found string) bool {
+	if want == kindAny || found == kindAny {
+		return true
+	}
+	for _, kind := range strings.Split(want, " or ") {
+		if kind == found {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeCheckError is returned by the first Step of an interpreter created
+// WithTypeCheck for a program that CheckTypes finds problems in
+type TypeCheckError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *TypeCheckError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for index, d := range e.Diagnostics {
+		messages[index] = d.String()
+	}
+	return "type check failed: " + strings.Join(messages, "; ")
+}
+
+// WithTypeCheck sets whether NewInterpreter checks the program with CheckTypes
+// before running it. A program with type mismatches returns a *TypeCheckError
+// from its first Step instead of failing when the instruction is run.
+func WithTypeCheck(check bool) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.typeCheck = check
+	}
+}
+
+// checkTypes returns a *TypeCheckError if CheckTypes finds problems in the program
+func checkTypes(program *Program) error {
+	diagnostics, err := CheckTypes(program)
+	if err != nil {
+		return err
+	}
+	if len(diagnostics) > 0 {
+		return &TypeCheckError{Diagnostics: diagnostics}
+	}
+	return nil
+}
+
+// CheckTypes follows the kinds of the values on the stack along every path
+// through the program without running it, reporting instructions that would
+// consume a value of the wrong kind, such as sadd on ints. Kinds are known for
+// values pushed by the program's own instructions, and are not known for values
+// loaded from variables, memory or collections, returned by calls, or that
+// differ between the paths reaching an instruction. Values whose kinds are not
+// known are never reported. It returns an error if the program fails Verify.
+func CheckTypes(program *Program) ([]Diagnostic, error) {
+	if err := Verify(program); err != nil {
+		return nil, errors.Wrap(err, "unable to check types")
+	}
+	entry := 0
+	if program.entry != 0 {
+		entry, _ = program.lineStart(program.entry)
+	}
+
+	// procedures, coroutines and handlers start with values whose kinds are not known
+	states := map[int][]string{}
+	work := []int{}
+	reach := func(ip int, stack []string) {
+		if ip >= len(program.instructions) {
+			return
+		}
+		previous, ok := states[ip]
+		if ok {
+			stack = mergeKinds(previous, stack)
+			if equalKinds(previous, stack) {
+				return
+			}
+		}
+		states[ip] = stack
+		work = append(work, ip)
+	}
+	reach(entry, nil)
+	program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		switch op {
+		case OpCall, OpTailCall, OpSpawn, OpCpush:
+			if target, ok := program.lineStart(program.instructions[ip+1].(int)); ok {
+				reach(target, nil)
+			}
+		}
+		return nil
+	})
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		op := program.instructions[ip].(OpCode)
+		next := program.transferKinds(ip, op, states[ip], nil)
+
+		targets, continues := program.flowOf(ip, op)
+		for _, target := range targets {
+			if op == OpTry {
+				reach(target, nil)
+				continue
+			}
+			reach(target, next)
+		}
+		if continues {
+			reach(ip+1+len(instructionSignatures()[opMnemonics()[op]].args), next)
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for ip, stack := range states {
+		program.transferKinds(ip, program.instructions[ip].(OpCode), stack, func(d Diagnostic) {
+			diagnostics = append(diagnostics, d)
+		})
+	}
+	sortDiagnostics(diagnostics)
+	return diagnostics, nil
+}
+
+// transferKinds returns the kinds of the values on the stack after the
+// instruction op at ip runs with a stack of the given kinds, top last. The
+// stack holds only the values whose kinds are followed; values below them are
+// not known. Mismatched kinds are passed to report when it is not nil.
+func (p *Program) transferKinds(ip int, op OpCode, stack []string, report func(Diagnostic)) []string {
+	args := p.instructions[ip+1:]
+	mnemonic := opMnemonics()[op]
+
+	// top returns the kind of the value n below the top of the stack
+	top := func(n int) string {
+		if n >= len(stack) {
+			return kindAny
+		}
+		return stack[len(stack)-1-n]
+	}
+	// replace returns the stack with n values consumed and the given kinds left in their place
+	replace := func(n int, out ...string) []string {
+		next := make([]string, 0, len(stack)+len(out))
+		if n < len(stack) {
+			next = append(next, stack[:len(stack)-n]...)
+		}
+		return append(next, out...)
+	}
+
+	switch op {
+	case OpDup:
+		return replace(0, top(0))
+	case OpSwap:
+		return replace(2, top(0), top(1))
+	case OpOver:
+		return replace(0, top(1))
+	case OpRot:
+		return replace(3, top(1), top(0), top(2))
+	case OpTypeof:
+		return replace(0, "string")
+	case OpPick:
+		n := args[0].(int)
+		if n < 0 {
+			// the instruction fails when it runs
+			return nil
+		}
+		return replace(0, top(n))
+	case OpDupn:
+		n := args[0].(int)
+		if n < 0 {
+			return nil
+		}
+		copies := make([]string, n)
+		for index := range copies {
+			copies[index] = top(n - 1 - index)
+		}
+		return replace(0, copies...)
+	case OpLoadc:
+		index := args[0].(int)
+		if index >= 0 && index < len(p.constants) {
+			if kind, ok := dataKind(p.constants[index]); ok {
+				return replace(0, kind)
+			}
+		}
+		return replace(0, kindAny)
+	case OpCalli:
+		if report != nil && !acceptsKind("function", top(0)) {
+			report(p.diagnostic(ip, "%s expects function, found %s", mnemonic, top(0)))
+		}
+		return nil
+	case OpCall, OpTailCall, OpHostcall:
+		// the kinds left by calls, and how many values they consume, are not known
+		return nil
+	case OpClear:
+		return nil
+	case OpSfmt:
+		return replace(countVerbs(args[0].(string)), "string")
+	}
+
+	signature, ok := kindSignatures[op]
+	if !ok {
+		effect, ok := p.effectOf(ip, op)
+		if !ok {
+			return nil
+		}
+		out := make([]string, effect.pushes)
+		for index := range out {
+			out[index] = kindAny
+		}
+		return replace(effect.pops, out...)
+	}
+	if report != nil {
+		// values are consumed from the top, so the first mismatch there is the one that fails
+		for n := 0; n < len(signature.in); n++ {
+			want, found := signature.in[len(signature.in)-1-n], top(n)
+			if !acceptsKind(want, found) {
+				report(p.diagnostic(ip, "%s expects %s, found %s", mnemonic, want, found))
+				break
+			}
+		}
+	}
+	return replace(len(signature.in), signature.out...)
+}
+
+// mergeKinds returns the kinds of the values on the stack where paths with
+// stacks a and b meet, following only the values both paths know the kinds of
+func mergeKinds(a, b []string) []string {
+	n := smaller(len(a), len(b))
+	merged := make([]string, n)
+	for index := 1; index <= n; index++ {
+		kind := a[len(a)-index]
+		if kind != b[len(b)-index] {
+			kind = kindAny
+		}
+		merged[n-index] = kind
+	}
+	return merged
+}
+
+func equalKinds(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package crust
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTypesNegativeArguments(t *testing.T) {
+	for _, src := range []string{
+		"ipush 1\npick -1\nput",
+		"ipush 1\ndupn -1\nput",
+	} {
+		program, err := NewProgramFromReader(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("unable to parse %q: %v", src, err)
+		}
+		diagnostics, err := CheckTypes(program)
+		if err != nil {
+			t.Fatalf("unable to check %q: %v", src, err)
+		}
+		if len(diagnostics) != 0 {
+			t.Fatalf("expected no diagnostics for %q, got %v", src, diagnostics)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package crust
+
+import (
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// WithVerification sets whether NewInterpreter verifies the program with Verify
+// before running it, which it does by default. A program that fails
+// verification returns the error from its first Step.
+func WithVerification(verify bool) InterpreterOption {
+	return func(interpreter *Interpreter) {
+		interpreter.verify = verify
+	}
+}
+
+// Verify checks that a program is well formed: its instructions are op codes
+// each followed by the arguments of their signature, with values of the right
+// types, its jump table refers to the start of instructions, and every line
+// number argument, including the offsets of relative jumps, refers to a line of
+// the program. Line numbers computed at runtime, such as those pushed for
+// jumpd, cannot be checked until they are used.
+func Verify(program *Program) error {
+	starts := make(map[int]bool)
+	err := program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		starts[ip] = true
+		for index, argType := range signature.args {
+			if !isArgOfType(argType, program.instructions[ip+1+index]) {
+				return errors.Errorf("invalid %s argument %d of %s at ip %d: %v", argType, index+1, opMnemonics()[op], ip, program.instructions[ip+1+index])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to verify program")
+	}
+	starts[len(program.instructions)] = true
+	for index, ip := range program.jumpTable {
+		if !starts[ip] {
+			return errors.Errorf("invalid program, line %d starts at ip %d inside an instruction", index+1, ip)
+		}
+	}
+
+	checkLine := func(op OpCode, ip, line int) error {
+		if line < 1 || line > len(program.jumpTable) {
+			return errors.Errorf("invalid program, %s at ip %d refers to line %d of %d", opMnemonics()[op], ip, line, len(program.jumpTable))
+		}
+		return nil
+	}
+	return program.decode(func(ip int, op OpCode, signature instructionSignature) error {
+		args := program.instructions[ip+1 : ip+1+len(signature.args)]
+		switch op {
+		case OpJrel:
+			return checkLine(op, ip, program.lineOf(ip)+args[0].(int))
+		case OpJrell:
+			return checkLine(op, ip, program.lineOf(ip)+args[1].(int))
+		case OpJumpTable:
+			for _, line := range args[0].([]int) {
+				if err := checkLine(op, ip, line); err != nil {
+					return err
+				}
+			}
+		}
+		for index, argType := range signature.args {
+			if argType == ArgLine {
+				if err := checkLine(op, ip, args[index].(int)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// isArgOfType reports whether value is an argument of the type argType as it is stored in a program
+func isArgOfType(argType ArgType, value interface{}) bool {
+	switch value.(type) {
+	case int:
+		return argType == ArgInt || argType == ArgLine
+	case string:
+		return argType == ArgString
+	case float64:
+		return argType == ArgFloat
+	case bool:
+		return argType == ArgBool
+	case []int:
+		return argType == ArgIntList
+	case *big.Int:
+		return argType == ArgBigInt
+	}
+	return false
+}